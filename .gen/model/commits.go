@@ -18,4 +18,7 @@ type Commits struct {
 	GitDiffCommandOutput *string
 	ExcludeFiles         *string
 	DateCreated          *time.Time
+	Sha                  *string
+	AmendedSha           *string
+	PreviousMessage      *string
 }
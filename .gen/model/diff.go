@@ -19,4 +19,8 @@ type Diff struct {
 	Model              *string
 	AiProvider         *string
 	Prompts            *string
+	ContextWindow      *int32
+	Tokenizer          *string
+	ParsedDiffJSON     *string
+	DiffContext        *string
 }
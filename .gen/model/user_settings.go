@@ -18,4 +18,7 @@ type UserSettings struct {
 	ExcludeFiles           *string
 	UseConventionalCommits *bool
 	DateCreated            *time.Time
+	RequestTimeoutSeconds  *int32
+	MaxRetries             *int32
+	Language               *string
 }
@@ -23,6 +23,9 @@ type commitsTable struct {
 	GitDiffCommandOutput sqlite.ColumnString
 	ExcludeFiles         sqlite.ColumnString
 	DateCreated          sqlite.ColumnTimestamp
+	Sha                  sqlite.ColumnString
+	AmendedSha           sqlite.ColumnString
+	PreviousMessage      sqlite.ColumnString
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -69,8 +72,11 @@ func newCommitsTableImpl(schemaName, tableName, alias string) commitsTable {
 		GitDiffCommandOutputColumn = sqlite.StringColumn("git_diff_command_output")
 		ExcludeFilesColumn         = sqlite.StringColumn("exclude_files")
 		DateCreatedColumn          = sqlite.TimestampColumn("date_created")
-		allColumns                 = sqlite.ColumnList{IDColumn, CommitMessageColumn, GitDiffCommandColumn, GitDiffCommandOutputColumn, ExcludeFilesColumn, DateCreatedColumn}
-		mutableColumns             = sqlite.ColumnList{CommitMessageColumn, GitDiffCommandColumn, GitDiffCommandOutputColumn, ExcludeFilesColumn, DateCreatedColumn}
+		ShaColumn                  = sqlite.StringColumn("sha")
+		AmendedShaColumn           = sqlite.StringColumn("amended_sha")
+		PreviousMessageColumn      = sqlite.StringColumn("previous_message")
+		allColumns                 = sqlite.ColumnList{IDColumn, CommitMessageColumn, GitDiffCommandColumn, GitDiffCommandOutputColumn, ExcludeFilesColumn, DateCreatedColumn, ShaColumn, AmendedShaColumn, PreviousMessageColumn}
+		mutableColumns             = sqlite.ColumnList{CommitMessageColumn, GitDiffCommandColumn, GitDiffCommandOutputColumn, ExcludeFilesColumn, DateCreatedColumn, ShaColumn, AmendedShaColumn, PreviousMessageColumn}
 	)
 
 	return commitsTable{
@@ -83,6 +89,9 @@ func newCommitsTableImpl(schemaName, tableName, alias string) commitsTable {
 		GitDiffCommandOutput: GitDiffCommandOutputColumn,
 		ExcludeFiles:         ExcludeFilesColumn,
 		DateCreated:          DateCreatedColumn,
+		Sha:                  ShaColumn,
+		AmendedSha:           AmendedShaColumn,
+		PreviousMessage:      PreviousMessageColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -24,6 +24,10 @@ type diffTable struct {
 	Model              sqlite.ColumnString
 	AiProvider         sqlite.ColumnString
 	Prompts            sqlite.ColumnString
+	ContextWindow      sqlite.ColumnInteger
+	Tokenizer          sqlite.ColumnString
+	ParsedDiffJSON     sqlite.ColumnString
+	DiffContext        sqlite.ColumnString
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -71,8 +75,12 @@ func newDiffTableImpl(schemaName, tableName, alias string) diffTable {
 		ModelColumn              = sqlite.StringColumn("model")
 		AiProviderColumn         = sqlite.StringColumn("ai_provider")
 		PromptsColumn            = sqlite.StringColumn("prompts")
-		allColumns               = sqlite.ColumnList{IDColumn, DiffColumn, DateCreatedColumn, DiffStructuredJSONColumn, ModelColumn, AiProviderColumn, PromptsColumn}
-		mutableColumns           = sqlite.ColumnList{DiffColumn, DateCreatedColumn, DiffStructuredJSONColumn, ModelColumn, AiProviderColumn, PromptsColumn}
+		ContextWindowColumn      = sqlite.IntegerColumn("context_window")
+		TokenizerColumn          = sqlite.StringColumn("tokenizer")
+		ParsedDiffJSONColumn     = sqlite.StringColumn("parsed_diff_json")
+		DiffContextColumn        = sqlite.StringColumn("diff_context")
+		allColumns               = sqlite.ColumnList{IDColumn, DiffColumn, DateCreatedColumn, DiffStructuredJSONColumn, ModelColumn, AiProviderColumn, PromptsColumn, ContextWindowColumn, TokenizerColumn, ParsedDiffJSONColumn, DiffContextColumn}
+		mutableColumns           = sqlite.ColumnList{DiffColumn, DateCreatedColumn, DiffStructuredJSONColumn, ModelColumn, AiProviderColumn, PromptsColumn, ContextWindowColumn, TokenizerColumn, ParsedDiffJSONColumn, DiffContextColumn}
 	)
 
 	return diffTable{
@@ -86,6 +94,10 @@ func newDiffTableImpl(schemaName, tableName, alias string) diffTable {
 		Model:              ModelColumn,
 		AiProvider:         AiProviderColumn,
 		Prompts:            PromptsColumn,
+		ContextWindow:      ContextWindowColumn,
+		Tokenizer:          TokenizerColumn,
+		ParsedDiffJSON:     ParsedDiffJSONColumn,
+		DiffContext:        DiffContextColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -11,8 +11,13 @@ package table
 // this method only once at the beginning of the program.
 func UseSchema(schema string) {
 	Aicommit = Aicommit.FromSchema(schema)
+	CommitClassification = CommitClassification.FromSchema(schema)
+	CommitEmbedding = CommitEmbedding.FromSchema(schema)
+	CommitExplanation = CommitExplanation.FromSchema(schema)
 	Commits = Commits.FromSchema(schema)
 	Diff = Diff.FromSchema(schema)
 	GooseDbVersion = GooseDbVersion.FromSchema(schema)
+	ModelCatalog = ModelCatalog.FromSchema(schema)
+	TeamMember = TeamMember.FromSchema(schema)
 	UserSettings = UserSettings.FromSchema(schema)
 }
@@ -23,6 +23,9 @@ type userSettingsTable struct {
 	ExcludeFiles           sqlite.ColumnString
 	UseConventionalCommits sqlite.ColumnBool
 	DateCreated            sqlite.ColumnTimestamp
+	RequestTimeoutSeconds  sqlite.ColumnInteger
+	MaxRetries             sqlite.ColumnInteger
+	Language               sqlite.ColumnString
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -69,8 +72,11 @@ func newUserSettingsTableImpl(schemaName, tableName, alias string) userSettingsT
 		ExcludeFilesColumn           = sqlite.StringColumn("exclude_files")
 		UseConventionalCommitsColumn = sqlite.BoolColumn("use_conventional_commits")
 		DateCreatedColumn            = sqlite.TimestampColumn("date_created")
-		allColumns                   = sqlite.ColumnList{IDColumn, AiProviderColumn, ModelSelectionColumn, ExcludeFilesColumn, UseConventionalCommitsColumn, DateCreatedColumn}
-		mutableColumns               = sqlite.ColumnList{AiProviderColumn, ModelSelectionColumn, ExcludeFilesColumn, UseConventionalCommitsColumn, DateCreatedColumn}
+		RequestTimeoutSecondsColumn  = sqlite.IntegerColumn("request_timeout_seconds")
+		MaxRetriesColumn             = sqlite.IntegerColumn("max_retries")
+		LanguageColumn               = sqlite.StringColumn("language")
+		allColumns                   = sqlite.ColumnList{IDColumn, AiProviderColumn, ModelSelectionColumn, ExcludeFilesColumn, UseConventionalCommitsColumn, DateCreatedColumn, RequestTimeoutSecondsColumn, MaxRetriesColumn, LanguageColumn}
+		mutableColumns               = sqlite.ColumnList{AiProviderColumn, ModelSelectionColumn, ExcludeFilesColumn, UseConventionalCommitsColumn, DateCreatedColumn, RequestTimeoutSecondsColumn, MaxRetriesColumn, LanguageColumn}
 	)
 
 	return userSettingsTable{
@@ -83,6 +89,9 @@ func newUserSettingsTableImpl(schemaName, tableName, alias string) userSettingsT
 		ExcludeFiles:           ExcludeFilesColumn,
 		UseConventionalCommits: UseConventionalCommitsColumn,
 		DateCreated:            DateCreatedColumn,
+		RequestTimeoutSeconds:  RequestTimeoutSecondsColumn,
+		MaxRetries:             MaxRetriesColumn,
+		Language:               LanguageColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
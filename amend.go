@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const amendPrompt = "\nThe commit is being amended. Its current message is given after the diff. Update it so it describes the combined change, not only the latest edits.\n"
+
+// emptyTreeSHA is git's empty tree, which stands in for HEAD^ when the
+// commit being amended is the root commit
+const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+func amendBase() string {
+	if _, err := runGit("rev-parse", "--verify", "--quiet", "HEAD^"); err == nil {
+		return "HEAD^"
+	}
+	return emptyTreeSHA
+}
+
+// amendDiffArgs compares the commit's parent with the index, i.e. what
+// HEAD will contain once amended
+func amendDiffArgs() []string {
+	return []string{"--cached", amendBase()}
+}
+
+func getAmendDiff(budget int) (string, diffContext, error) {
+	diff, usedContext, err := contextDiff(budget, amendDiffArgs()...)
+	if err != nil {
+		return "", usedContext, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", usedContext, newAppError(ErrNoChanges, errors.New("amending would leave an empty commit"))
+	}
+	return diff, usedContext, nil
+}
+
+func headMessage() (string, error) {
+	return runGit("log", "-1", "--format=%B", "HEAD")
+}
+
+// amendCommit amends HEAD with the staged changes and the given message and
+// records the amendment, so the chain of rewritten commits can be traced.
+// The diff recorded is the one the message was generated from, with the
+// context it was taken with.
+func amendCommit(cdb *CommitDB, message string, diff string, usedContext diffContext) (string, error) {
+	amendedSHA, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	previousMessage, err := headMessage()
+	if err != nil {
+		return "", err
+	}
+	diffCommand := usedContext.Command(amendDiffArgs()...)
+	if _, err := runGitRaw(message+"\n", "commit", "--amend", "--quiet", "--file=-"); err != nil {
+		return "", err
+	}
+	sha, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	dateCreated := time.Now()
+	_, err = cdb.InsertCommit(dbmodel.Commits{
+		CommitMessage:        &message,
+		GitDiffCommand:       &diffCommand,
+		GitDiffCommandOutput: &diff,
+		DateCreated:          &dateCreated,
+		Sha:                  &sha,
+		AmendedSha:           &amendedSHA,
+		PreviousMessage:      &previousMessage,
+	})
+	if err != nil {
+		return sha, err
+	}
+	return sha, nil
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+// changelogSections are the Keep a Changelog sections, in the order they
+// are written. Commits in changelogSkip are left out.
+var changelogSections = []string{"Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+
+const changelogSkip = "Skip"
+
+// conventionalTypeSections maps Conventional Commit types to sections.
+// Types that aren't listed are classified by the model instead.
+var conventionalTypeSections = map[string]string{
+	"feat":       "Added",
+	"fix":        "Fixed",
+	"perf":       "Changed",
+	"refactor":   "Changed",
+	"revert":     "Changed",
+	"deprecate":  "Deprecated",
+	"remove":     "Removed",
+	"security":   "Security",
+	"docs":       changelogSkip,
+	"style":      changelogSkip,
+	"test":       changelogSkip,
+	"build":      changelogSkip,
+	"ci":         changelogSkip,
+	"chore":      changelogSkip,
+	"release":    changelogSkip,
+	"wip":        changelogSkip,
+	"dependabot": changelogSkip,
+}
+
+// classifyBatchSize is how many commits are sent to the model at once
+const classifyBatchSize = 40
+
+const classifyCommitsPrompt = `You sort commits into changelog sections following Keep a Changelog.
+Pick one section per commit: Added, Changed, Deprecated, Removed, Fixed or Security. Use Skip for changes users won't notice, such as tests, CI, formatting or internal refactoring.
+Rewrite each subject as a short changelog entry for users of the project, starting with a capital letter and without a trailing period.
+Set breaking to true when the commit breaks existing behaviour.
+Answer with JSON only, in this shape:
+{"commits": [{"sha": "...", "section": "...", "entry": "...", "breaking": false}]}
+`
+
+const changelogHeader = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/).
+`
+
+var conventionalHeaderRegex = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.+)$`)
+var breakingFooterRegex = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+
+// ConventionalHeader is a parsed Conventional Commits subject line
+type ConventionalHeader struct {
+	Type        string
+	Scope       string
+	Breaking    bool
+	Description string
+}
+
+// parseConventionalHeader parses a subject like "feat(api)!: add x". The
+// body is only read for a BREAKING CHANGE footer and may be empty.
+func parseConventionalHeader(subject string, body string) (ConventionalHeader, bool) {
+	match := conventionalHeaderRegex.FindStringSubmatch(strings.TrimSpace(subject))
+	if match == nil {
+		return ConventionalHeader{}, false
+	}
+	return ConventionalHeader{
+		Type:        strings.ToLower(match[1]),
+		Scope:       match[2],
+		Breaking:    match[3] == "!" || breakingFooterRegex.MatchString(body),
+		Description: match[4],
+	}, true
+}
+
+type changelogEntry struct {
+	SHA      string `json:"sha"`
+	Section  string `json:"section"`
+	Entry    string `json:"entry"`
+	Breaking bool   `json:"breaking"`
+}
+
+// classifyCommits sorts commits into changelog sections. Conventional
+// Commits are mapped by type and gitmoji commits by their gitmoji;
+// everything else is classified by the model once and cached by SHA.
+func classifyCommits(ctx context.Context, cdb *CommitDB, commits []gitCommit, gitmojis []Gitmoji) ([]changelogEntry, error) {
+	entries := make([]changelogEntry, len(commits))
+	var unknown []string
+	for i, commit := range commits {
+		entries[i].SHA = commit.SHA
+		header, ok := parseConventionalHeader(commit.Subject, commit.Body)
+		if section, known := conventionalTypeSections[header.Type]; ok && known {
+			entries[i].Section = section
+			entries[i].Entry = capitalize(header.Description)
+			entries[i].Breaking = header.Breaking
+			if header.Breaking && section == changelogSkip {
+				// Breaking changes are always worth a line
+				entries[i].Section = "Changed"
+			}
+			if header.Scope != "" {
+				entries[i].Entry = fmt.Sprintf("**%s:** %s", header.Scope, entries[i].Entry)
+			}
+			continue
+		}
+		if gitmoji, description, ok := parseGitmojiSubject(commit.Subject, gitmojis); ok {
+			entries[i].Section = gitmoji.Section
+			entries[i].Entry = capitalize(description)
+			entries[i].Breaking = gitmoji.Code == gitmojiBreakingCode || breakingFooterRegex.MatchString(commit.Body)
+			if entries[i].Breaking && gitmoji.Section == changelogSkip {
+				entries[i].Section = "Changed"
+			}
+			continue
+		}
+		unknown = append(unknown, commit.SHA)
+	}
+
+	cached, err := cdb.GetCommitClassifications(unknown)
+	if err != nil {
+		return nil, err
+	}
+	classified := map[string]changelogEntry{}
+	for _, row := range cached {
+		classified[*row.Sha] = changelogEntry{SHA: *row.Sha, Section: *row.Section, Entry: *row.Entry, Breaking: *row.Breaking}
+	}
+
+	var pending []gitCommit
+	for _, commit := range commits {
+		if _, done := classified[commit.SHA]; !done && StringInSlice(commit.SHA, unknown) {
+			pending = append(pending, commit)
+		}
+	}
+	if len(pending) > 0 {
+		client, err := loadLLMClient(cdb)
+		if err != nil {
+			return nil, err
+		}
+		client.onRetry = func(status RetryStatus) {
+			fmt.Fprintln(os.Stderr, status.String())
+		}
+		for start := 0; start < len(pending); start += classifyBatchSize {
+			batch := pending[start:min(start+classifyBatchSize, len(pending))]
+			fmt.Fprintf(os.Stderr, "Classifying %d commits\n", len(batch))
+			results, err := classifyBatch(ctx, client, batch)
+			if err != nil {
+				return nil, err
+			}
+			for _, result := range results {
+				classified[result.SHA] = result
+				dateCreated := time.Now()
+				_, err := cdb.UpsertCommitClassification(dbmodel.CommitClassification{
+					Sha:         &result.SHA,
+					Section:     &result.Section,
+					Entry:       &result.Entry,
+					Breaking:    &result.Breaking,
+					Model:       &client.model,
+					DateCreated: &dateCreated,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for i := range entries {
+		if result, ok := classified[entries[i].SHA]; ok {
+			entries[i] = result
+		}
+	}
+	return entries, nil
+}
+
+// classifyBatch asks the model about a batch of commits. Answers for
+// commits that weren't asked about are dropped, and unknown sections are
+// treated as Changed.
+func classifyBatch(ctx context.Context, client *llmClient, commits []gitCommit) ([]changelogEntry, error) {
+	var human strings.Builder
+	for _, commit := range commits {
+		fmt.Fprintf(&human, "sha: %s\nsubject: %s\n", commit.SHA, commit.Subject)
+		if commit.Body != "" {
+			fmt.Fprintf(&human, "body:\n  %s\n", strings.ReplaceAll(commit.Body, "\n", "\n  "))
+		}
+		human.WriteString("\n")
+	}
+	answer, err := client.Complete(ctx, classifyCommitsPrompt, human.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := extractJSON(answer)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Commits []changelogEntry `json:"commits"`
+	}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("could not read the commit classification: %w", err)
+	}
+
+	var results []changelogEntry
+	for _, result := range parsed.Commits {
+		asked := false
+		for _, commit := range commits {
+			if commit.SHA == result.SHA {
+				asked = true
+			}
+		}
+		if !asked {
+			continue
+		}
+		if result.Section != changelogSkip && !StringInSlice(result.Section, changelogSections) {
+			result.Section = "Changed"
+		}
+		result.Entry = strings.TrimSuffix(strings.TrimSpace(result.Entry), ".")
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// renderChangelog writes one release section. An empty date leaves it out,
+// as for Unreleased.
+func renderChangelog(version string, date string, entries []changelogEntry) string {
+	var b strings.Builder
+	if date != "" {
+		fmt.Fprintf(&b, "## [%s] - %s\n", version, date)
+	} else {
+		fmt.Fprintf(&b, "## [%s]\n", version)
+	}
+	for _, section := range changelogSections {
+		var lines []string
+		for _, entry := range entries {
+			if entry.Section != section || entry.Entry == "" {
+				continue
+			}
+			line := entry.Entry
+			if entry.Breaking {
+				line = "**Breaking:** " + line
+			}
+			lines = append(lines, fmt.Sprintf("- %s (%s)", line, shortSHA(entry.SHA)))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n%s\n", section, strings.Join(lines, "\n"))
+	}
+	return b.String()
+}
+
+// prependChangelog adds a release section above the newest one in an
+// existing changelog. Every section with the same heading is replaced, so
+// reruns don't duplicate it. Unreleased is replaced as well when the newest
+// version is cut; an older version goes below it instead. The link
+// definitions at the end of the file are kept.
+func prependChangelog(existing string, version string, section string, newest bool) string {
+	if strings.TrimSpace(existing) == "" {
+		existing = changelogHeader
+	}
+	lines := strings.Split(existing, "\n")
+	insertAt := -1
+	var kept []string
+	replacing := false
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "## "):
+			unreleased := strings.HasPrefix(line, "## [Unreleased]")
+			if insertAt < 0 && (newest || !unreleased) {
+				insertAt = len(kept)
+			}
+			replacing = strings.HasPrefix(line, "## ["+version+"]") || (newest && unreleased)
+		case changelogLinkRegex.MatchString(line):
+			replacing = false
+		}
+		if !replacing {
+			kept = append(kept, line)
+		}
+	}
+	if insertAt < 0 {
+		insertAt = len(kept)
+	}
+
+	before := strings.TrimRight(strings.Join(kept[:insertAt], "\n"), "\n")
+	after := strings.Join(kept[insertAt:], "\n")
+	result := before + "\n\n" + section
+	if strings.TrimSpace(after) != "" {
+		result += "\n" + after
+	}
+	return strings.TrimRight(result, "\n") + "\n"
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// changelogLinkRegex matches the link reference definitions Keep a
+// Changelog puts below the sections, like "[1.2.0]: https://…"
+var changelogLinkRegex = regexp.MustCompile(`^\[[^\]]+\]:\s*\S`)
+
+// previousTag is the newest tag before ref, or "" when there is none
+func previousTag(ref string) string {
+	tag, err := runGit("describe", "--tags", "--abbrev=0", ref+"^")
+	if err != nil {
+		return ""
+	}
+	return tag
+}
+
+func newChangelogCmd(cdb *CommitDB) *cobra.Command {
+	var from string
+	var to string
+	var version string
+	var prependFile string
+	cmdChangelog := &cobra.Command{
+		Use:   "changelog",
+		Short: "Generate a Keep a Changelog section for a range of commits",
+		Args:  cobra.NoArgs,
+		Long: "Collects the commits between two refs and groups them into Keep a Changelog sections. " +
+			"Conventional Commits are sorted by type and gitmoji commits by gitmoji, other commits are classified by the model and cached.",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				if from == "" {
+					from = previousTag(to)
+				}
+				revRange := to
+				if from != "" {
+					revRange = from + ".." + to
+				}
+				commits, err := logCommits(revRange, "--no-merges")
+				if err != nil {
+					return err
+				}
+				if len(commits) == 0 {
+					return newAppError(ErrNoChanges, fmt.Errorf("no commits in %s", revRange))
+				}
+
+				date := ""
+				if version == "" {
+					version = "Unreleased"
+					if tag, err := runGit("describe", "--tags", "--exact-match", to); err == nil {
+						version = tag
+						date, _ = runGit("log", "-1", "--format=%cs", to)
+					}
+				} else {
+					date = time.Now().Format(time.DateOnly)
+				}
+
+				repoConfig, err := loadRepoConfig()
+				if err != nil {
+					return err
+				}
+				entries, err := classifyCommits(cmd.Context(), cdb, commits, repoConfig.Lint.Gitmojis)
+				if err != nil {
+					return err
+				}
+				section := renderChangelog(version, date, entries)
+				if prependFile == "" {
+					fmt.Print(section)
+					return nil
+				}
+
+				existing, err := os.ReadFile(prependFile)
+				if err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				// Unreleased stays until the newest commits are released
+				newest := true
+				if version != "Unreleased" {
+					head, _ := runGit("rev-parse", "HEAD")
+					target, _ := runGit("rev-parse", to+"^{commit}")
+					newest = head != "" && head == target
+				}
+				if err := os.WriteFile(prependFile, []byte(prependChangelog(string(existing), version, section, newest)), 0o644); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "Updated %s\n", prependFile)
+				return nil
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+	cmdChangelog.Flags().StringVar(&from, "from", "", "start of the range, defaults to the previous tag")
+	cmdChangelog.Flags().StringVar(&to, "to", "HEAD", "end of the range")
+	cmdChangelog.Flags().StringVar(&version, "version", "", "release heading, defaults to the tag at --to or Unreleased")
+	cmdChangelog.Flags().StringVar(&prependFile, "prepend", "", "prepend the section to this changelog file instead of printing it")
+	cmdChangelog.Flags().Lookup("prepend").NoOptDefVal = "CHANGELOG.md"
+	return cmdChangelog
+}
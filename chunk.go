@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+// chunkFile is one file (or piece of a large file) as returned by the
+// Python chunker
+type chunkFile struct {
+	FileName   string `json:"file_name"`
+	FileDiff   string `json:"file_diff"`
+	TokenCount int    `json:"token_count"`
+}
+
+// chunkDiffMu serialises chunkDiff, since the diff table holds a single row
+// that the chunker reads back
+var chunkDiffMu sync.Mutex
+
+// chunkDiff runs a condensed diff through the Python chunker, which groups
+// the files so that each group plus the prompts fits the model's context
+// window. The raw diff, the context it was taken with and the chunks are
+// kept in the diff table.
+func chunkDiff(cdb *CommitDB, gitDiff string, usedContext diffContext, condensed CondensedDiff, modelInfo ModelInfo, prompts []string) ([][]chunkFile, error) {
+	chunkDiffMu.Lock()
+	defer chunkDiffMu.Unlock()
+	parsedDiffBytes, err := json.Marshal(condensed)
+	if err != nil {
+		return nil, err
+	}
+	parsedDiffJSON := string(parsedDiffBytes)
+	promptBytes, err := json.Marshal(prompts)
+	if err != nil {
+		return nil, err
+	}
+	promptsJSON := string(promptBytes)
+
+	dateCreated := time.Now()
+	diffStructuredJson := ""
+	contextWindow := int32(modelInfo.ContextWindow)
+	contextDescription := usedContext.String()
+	_, err = cdb.InsertDiff(dbmodel.Diff{
+		Diff:               &gitDiff,
+		DateCreated:        &dateCreated,
+		DiffStructuredJSON: &diffStructuredJson,
+		Model:              &modelInfo.Name,
+		AiProvider:         &modelInfo.Provider,
+		Prompts:            &promptsJSON,
+		ContextWindow:      &contextWindow,
+		Tokenizer:          &modelInfo.Tokenizer,
+		ParsedDiffJSON:     &parsedDiffJSON,
+		DiffContext:        &contextDescription,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	main2()
+
+	structuredDiff, err := cdb.GetDiff()
+	if err != nil {
+		return nil, err
+	}
+	var chunks [][]chunkFile
+	if structuredDiff.DiffStructuredJSON != nil && *structuredDiff.DiffStructuredJSON != "" {
+		if err := json.Unmarshal([]byte(*structuredDiff.DiffStructuredJSON), &chunks); err != nil {
+			return nil, err
+		}
+	}
+	if len(chunks) == 0 {
+		// The chunker logs its own failures; fall back to a single chunk
+		log.Debug().Msg("no structured diff was produced")
+		chunks = [][]chunkFile{{{FileName: "diff", FileDiff: condensed.String()}}}
+	}
+	return chunks, nil
+}
+
+// chunkText joins the files of one chunk back into prompt text
+func chunkText(chunk []chunkFile) string {
+	var b strings.Builder
+	for _, file := range chunk {
+		b.WriteString(file.FileDiff + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileKind says whether a changed file is worth showing to the model in full
+type FileKind string
+
+const (
+	KindSource     FileKind = "source"
+	KindLockfile   FileKind = "lockfile"
+	KindBinary     FileKind = "binary"
+	KindLFSPointer FileKind = "lfs_pointer"
+	KindMinified   FileKind = "minified"
+	KindGenerated  FileKind = "generated"
+)
+
+var lockfileNames = []string{
+	"go.sum", "go.work.sum", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml",
+	"bun.lockb", "bun.lock", "Cargo.lock", "Gemfile.lock", "poetry.lock", "Pipfile.lock", "uv.lock",
+	"composer.lock", "mix.lock", "flake.lock", "Podfile.lock", "packages.lock.json", "pubspec.lock",
+}
+
+// minifiedLineLength is the line length above which a .js or .css line is
+// taken to be minified output
+const minifiedLineLength = 500
+
+// generatedHeaderRegex matches the generated-code banners tools actually
+// write: Go's "Code generated ... DO NOT EDIT." line, used by our .gen/ code
+// too, and the @generated tag. Looser phrases like "do not edit by hand"
+// turn up in ordinary comments.
+var generatedHeaderRegex = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$|@generated\b`)
+var generatedByRegex = regexp.MustCompile(`(?i)generated by ([\w./@-]+)`)
+
+// generatedHeaderLines is how far into a file we look for a banner
+const generatedHeaderLines = 10
+
+// ClassifyFile decides how a changed file should be presented to the model
+func ClassifyFile(f FileDiff) FileKind {
+	name := path.Base(f.Path())
+	switch {
+	case StringInSlice(name, lockfileNames):
+		return KindLockfile
+	case isLFSPointer(f):
+		return KindLFSPointer
+	case f.IsBinary:
+		return KindBinary
+	case isMinified(f):
+		return KindMinified
+	case generatorOf(f) != "":
+		return KindGenerated
+	}
+	return KindSource
+}
+
+func isLFSPointer(f FileDiff) bool {
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if len(line) > 0 && strings.HasPrefix(line[1:], "version https://git-lfs.github.com/spec/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isMinified(f FileDiff) bool {
+	name := path.Base(f.Path())
+	if strings.Contains(name, ".min.") || strings.HasSuffix(name, ".map") {
+		return true
+	}
+	ext := path.Ext(name)
+	if ext != ".js" && ext != ".mjs" && ext != ".cjs" && ext != ".css" {
+		return false
+	}
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if len(line) > minifiedLineLength {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generatorOf returns the tool named in a generated-code banner, "unknown"
+// when the banner doesn't name one, or "" for hand-written files. Banners
+// sit at the top of the file, which isn't always part of the diff, so the
+// new blob is checked as well.
+func generatorOf(f FileDiff) string {
+	var head []string
+	fromTop := false
+	for _, hunk := range f.Hunks {
+		if hunk.NewStart > generatedHeaderLines && hunk.OldStart > generatedHeaderLines {
+			continue
+		}
+		fromTop = fromTop || hunk.NewStart <= 1 || hunk.OldStart <= 1
+		for _, line := range hunk.Lines {
+			if len(line) > 0 {
+				head = append(head, line[1:])
+			}
+		}
+	}
+	// A hunk near the top can still miss the banner on line 1
+	if !fromTop && f.Status != FileDeleted {
+		head = append(readHead(f, generatedHeaderLines), head...)
+	}
+	for i, line := range head {
+		if i >= generatedHeaderLines*2 {
+			break
+		}
+		if !isCommentLine(line) || !generatedHeaderRegex.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		if match := generatedByRegex.FindStringSubmatch(line); match != nil {
+			return strings.TrimPrefix(path.Base(strings.TrimRight(match[1], ".")), "go-")
+		}
+		return "unknown"
+	}
+	return ""
+}
+
+func isCommentLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, marker := range []string{"//", "#", "/*", "*", "<!--", "--", ";", "%"} {
+		if strings.HasPrefix(trimmed, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// readHead returns the first lines of the file's new version. The blob is
+// read by its hash, so diffs of older commits see the file as it was then.
+// Unstaged changes have no blob yet and are read from the working tree.
+func readHead(f FileDiff, lines int) []string {
+	var content io.Reader
+	if blob, ok := readBlob(f.NewHash); ok {
+		content = strings.NewReader(blob)
+	} else {
+		file, err := os.Open(worktreePath(f.NewPath))
+		if err != nil {
+			return nil
+		}
+		defer file.Close()
+		content = file
+	}
+	var head []string
+	scanner := bufio.NewScanner(content)
+	for len(head) < lines && scanner.Scan() {
+		head = append(head, scanner.Text())
+	}
+	return head
+}
+
+// ---------------- Summaries ----------------
+
+// CondensedDiff is a diff with the noisy files taken out and replaced by one
+// line each (or one line per group of generated files)
+type CondensedDiff struct {
+	Files     []FileDiff `json:"files"`
+	Summaries []string   `json:"summaries"`
+}
+
+// CondenseDiff keeps source files as they are and summarises the rest
+func CondenseDiff(files []FileDiff) CondensedDiff {
+	condensed := CondensedDiff{Files: []FileDiff{}, Summaries: []string{}}
+	generated := map[string][]FileDiff{}
+	for _, f := range files {
+		switch kind := ClassifyFile(f); kind {
+		case KindSource:
+			condensed.Files = append(condensed.Files, f)
+		case KindGenerated:
+			key := generatorOf(f) + "\x00" + path.Dir(f.Path())
+			generated[key] = append(generated[key], f)
+		default:
+			condensed.Summaries = append(condensed.Summaries, summarizeFile(f, kind))
+		}
+	}
+
+	var keys []string
+	for key := range generated {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		generator, dir, _ := strings.Cut(key, "\x00")
+		condensed.Summaries = append(condensed.Summaries, summarizeGenerated(generator, dir, generated[key]))
+	}
+	return condensed
+}
+
+// String renders the condensed diff for a prompt
+func (c CondensedDiff) String() string {
+	var b strings.Builder
+	for _, f := range c.Files {
+		b.WriteString(f.Patch(f.AllHunks()))
+	}
+	if len(c.Summaries) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("Other changes, summarised:\n")
+		for _, summary := range c.Summaries {
+			b.WriteString("- " + summary + "\n")
+		}
+	}
+	return b.String()
+}
+
+func summarizeFile(f FileDiff, kind FileKind) string {
+	switch kind {
+	case KindLockfile:
+		if f.IsBinary {
+			return fmt.Sprintf("%s %s", f.Path(), statusVerb(f.Status))
+		}
+		return fmt.Sprintf("%s %s (+%d −%d lines)", f.Path(), statusVerb(f.Status), f.Added, f.Removed)
+	case KindLFSPointer:
+		oldSize, newSize := lfsSizes(f)
+		return fmt.Sprintf("LFS object %s %s%s", f.Path(), statusVerb(f.Status), sizeChange(f.Status, oldSize, newSize))
+	case KindBinary:
+		oldSize, newSize := binarySizes(f)
+		return fmt.Sprintf("%s %s %s%s", binaryDescription(f.Path()), f.Path(), statusVerb(f.Status), sizeChange(f.Status, oldSize, newSize))
+	case KindMinified:
+		return fmt.Sprintf("minified bundle %s %s (+%d −%d lines)", f.Path(), statusVerb(f.Status), f.Added, f.Removed)
+	}
+	return fmt.Sprintf("%s %s", f.Path(), statusVerb(f.Status))
+}
+
+func summarizeGenerated(generator string, dir string, files []FileDiff) string {
+	added, removed := 0, 0
+	for _, f := range files {
+		added += f.Added
+		removed += f.Removed
+	}
+	if len(files) == 1 {
+		return fmt.Sprintf("regenerated %s (generated by %s, +%d −%d lines)", files[0].Path(), generator, added, removed)
+	}
+	return fmt.Sprintf("regenerated %d %s files in %s (+%d −%d lines)", len(files), generator, dir, added, removed)
+}
+
+func statusVerb(status FileStatus) string {
+	switch status {
+	case FileAdded:
+		return "added"
+	case FileDeleted:
+		return "deleted"
+	case FileRenamed:
+		return "renamed"
+	case FileCopied:
+		return "copied"
+	}
+	return "updated"
+}
+
+func binaryDescription(filePath string) string {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".ico", ".bmp", ".tiff", ".avif":
+		return "binary image"
+	case ".ttf", ".otf", ".woff", ".woff2", ".eot":
+		return "font"
+	case ".zip", ".gz", ".tgz", ".tar", ".jar", ".7z", ".rar", ".xz":
+		return "archive"
+	case ".pdf":
+		return "PDF document"
+	case ".mp3", ".wav", ".ogg", ".flac", ".mp4", ".mov", ".webm":
+		return "media file"
+	case ".db", ".sqlite", ".sqlite3":
+		return "database file"
+	}
+	return "binary file"
+}
+
+// binarySizes looks up the blob sizes from the index line. Unstaged changes
+// have no new blob yet, so that side falls back to the file in the working
+// tree. Unknown sizes are -1.
+func binarySizes(f FileDiff) (int64, int64) {
+	oldSize, newSize := int64(-1), int64(-1)
+	if f.Status != FileAdded {
+		oldSize = blobSize(f.OldHash)
+	}
+	if f.Status != FileDeleted {
+		newSize = blobSize(f.NewHash)
+		if newSize < 0 {
+			if info, err := os.Stat(worktreePath(f.NewPath)); err == nil {
+				newSize = info.Size()
+			}
+		}
+	}
+	return oldSize, newSize
+}
+
+func blobSize(hash string) int64 {
+	if isNullHash(hash) {
+		return -1
+	}
+	out, err := runGit("cat-file", "-s", hash)
+	if err != nil {
+		return -1
+	}
+	size, err := strconv.ParseInt(out, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+func readBlob(hash string) (string, bool) {
+	if isNullHash(hash) {
+		return "", false
+	}
+	blob, err := runGitRaw("", "cat-file", "blob", hash)
+	return blob, err == nil
+}
+
+func isNullHash(hash string) bool {
+	return strings.Trim(hash, "0") == ""
+}
+
+// worktreePath resolves a path from a diff, which is relative to the top of
+// the repository, so it also works from a subdirectory
+func worktreePath(repoPath string) string {
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return repoPath
+	}
+	return filepath.Join(root, repoPath)
+}
+
+// lfsSizes reads the "size" lines of the old and new pointer
+func lfsSizes(f FileDiff) (int64, int64) {
+	oldSize, newSize := int64(-1), int64(-1)
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if len(line) < 1 || !strings.HasPrefix(line[1:], "size ") {
+				continue
+			}
+			size, err := strconv.ParseInt(strings.TrimPrefix(line[1:], "size "), 10, 64)
+			if err != nil {
+				continue
+			}
+			switch line[0] {
+			case '-':
+				oldSize = size
+			case '+':
+				newSize = size
+			default:
+				oldSize, newSize = size, size
+			}
+		}
+	}
+	return oldSize, newSize
+}
+
+func sizeChange(status FileStatus, oldSize int64, newSize int64) string {
+	switch {
+	case status == FileAdded && newSize >= 0:
+		return fmt.Sprintf(" (%s)", formatSize(newSize))
+	case status == FileDeleted && oldSize >= 0:
+		return fmt.Sprintf(" (%s)", formatSize(oldSize))
+	case oldSize >= 0 && newSize >= 0:
+		return fmt.Sprintf(" (%s→%s)", formatSize(oldSize), formatSize(newSize))
+	}
+	return ""
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%dKB", (size+512)/1024)
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/huh"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+// openCoAuthors shows the team roster with the current co-authors checked
+func (m model) openCoAuthors() (model, tea.Cmd) {
+	roster, err := m.cdb.GetTeamMembers()
+	if err != nil {
+		return m.showError(err)
+	}
+	if len(roster) == 0 {
+		m.genMessageState.status = "No team members yet, add them with aicommit team add"
+		return m, nil
+	}
+	selected := map[string]bool{}
+	for _, member := range m.coAuthorState.selected {
+		selected[member.Email] = true
+	}
+	var options []huh.Option[string]
+	for _, member := range roster {
+		options = append(options, huh.NewOption(member.Name+" <"+member.Email+">", member.Email).Selected(selected[member.Email]))
+	}
+	m.coAuthorState.roster = roster
+	m.coAuthorState.form = huh.NewForm(huh.NewGroup(
+		huh.NewMultiSelect[string]().
+			Key("co-authors").
+			Title("Who did you work with?").
+			Description("space to toggle, enter to confirm, esc to go back").
+			Options(options...),
+	))
+	m.view = CoAuthorView
+	return m, tea.Batch(m.coAuthorState.form.Init(), tea.ClearScreen)
+}
+
+func (m model) updateCoAuthorView(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.terminalWidth = msg.Width
+		m.terminalHeight = msg.Height
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		case "esc":
+			m.view = CommitMessageView
+			return m, tea.ClearScreen
+		}
+	}
+
+	form, cmd := m.coAuthorState.form.Update(msg)
+	if f, ok := form.(*huh.Form); ok {
+		m.coAuthorState.form = f
+	}
+	if m.coAuthorState.form.State != huh.StateCompleted {
+		return m, cmd
+	}
+
+	emails, _ := m.coAuthorState.form.Get("co-authors").([]string)
+	var coAuthors []dbmodel.TeamMember
+	for _, member := range m.coAuthorState.roster {
+		if StringInSlice(member.Email, emails) {
+			coAuthors = append(coAuthors, member)
+		}
+	}
+	m.coAuthorState.selected = coAuthors
+	m.view = CommitMessageView
+
+	// A message that is already there gets its co-authors updated right away
+	message := strings.TrimSpace(m.genMessageState.commitMessage.String())
+	if message != "" && !m.genMessageState.loading {
+		var added, removed []string
+		for _, member := range m.coAuthorState.roster {
+			if StringInSlice(member.Email, emails) {
+				added = append(added, coAuthorTrailer(member))
+			} else {
+				removed = append(removed, coAuthorTrailer(member))
+			}
+		}
+		message, err := appendTrailers(removeTrailers(message, removed), added)
+		if err != nil {
+			return m.showError(err)
+		}
+		m.genMessageState.commitMessage.Reset()
+		m.genMessageState.commitMessage.WriteString(message)
+	}
+	return m, tea.Batch(cmd, tea.ClearScreen)
+}
+
+func (m model) viewCoAuthorView() string {
+	return m.coAuthorState.form.View()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/spf13/cobra"
+)
+
+// repoConfigFile sits at the root of a repository and holds the settings a
+// team shares, as opposed to the per-user settings in the database
+const repoConfigFile = ".aicommit.json"
+
+// Language overrides the language set in the profile, see messageLanguage
+type RepoConfig struct {
+	Lint     LintConfig    `json:"lint"`
+	Ticket   TicketConfig  `json:"ticket"`
+	Trailers TrailerConfig `json:"trailers"`
+	Scopes   ScopeConfig   `json:"scopes"`
+	Language string        `json:"language"`
+}
+
+// TrailerConfig lists the trailers every generated message gets. Custom
+// trailers are written as "Key: value".
+type TrailerConfig struct {
+	SignOff bool     `json:"sign_off"`
+	Custom  []string `json:"custom"`
+}
+
+// TicketConfig says how ticket IDs are found and where they go in the
+// message. Placement is "subject", "body", "trailer" or "none". Tickets
+// are off until branch patterns are configured; the placement then
+// defaults to "trailer".
+type TicketConfig struct {
+	BranchPatterns []string `json:"branch_patterns"`
+	Placement      string   `json:"placement"`
+	SubjectFormat  string   `json:"subject_format"`
+	TrailerKey     string   `json:"trailer_key"`
+}
+
+// LintConfig holds the commit message rules. The generator is asked to
+// follow the same rules the linter checks. Style is "plain",
+// "conventional" or "gitmoji"; conventional is kept as a shorthand for the
+// conventional style.
+type LintConfig struct {
+	Style                 string    `json:"style"`
+	SubjectMaxLength      int       `json:"subject_max_length"`
+	Imperative            bool      `json:"imperative"`
+	NoTrailingPeriod      bool      `json:"no_trailing_period"`
+	BlankLineAfterSubject bool      `json:"blank_line_after_subject"`
+	BodyWrap              int       `json:"body_wrap"`
+	SubjectOnly           bool      `json:"subject_only"`
+	Conventional          bool      `json:"conventional"`
+	ConventionalTypes     []string  `json:"conventional_types"`
+	GitmojiFormat         string    `json:"gitmoji_format"`
+	Gitmojis              []Gitmoji `json:"gitmojis"`
+	RequiredTrailers      []string  `json:"required_trailers"`
+	RequireTicket         bool      `json:"require_ticket"`
+
+	// Scopes are the allowed Conventional Commits scopes. They are worked
+	// out from the "scopes" section, see loadRepoScopes.
+	Scopes []string `json:"-"`
+	// TicketPatterns are the branch patterns of the "ticket" section. A
+	// required ticket reference has to match one of them.
+	TicketPatterns []string `json:"-"`
+}
+
+func defaultRepoConfig() RepoConfig {
+	return RepoConfig{
+		Lint: LintConfig{
+			Style:                 "plain",
+			SubjectMaxLength:      72,
+			Imperative:            true,
+			NoTrailingPeriod:      true,
+			BlankLineAfterSubject: true,
+			BodyWrap:              72,
+			ConventionalTypes:     []string{"feat", "fix", "docs", "style", "refactor", "perf", "test", "build", "ci", "chore", "revert"},
+			GitmojiFormat:         "emoji",
+			Gitmojis:              append([]Gitmoji{}, canonicalGitmojis...),
+		},
+		Ticket: TicketConfig{
+			Placement:     "none",
+			SubjectFormat: "{ticket} ",
+			TrailerKey:    "Refs",
+		},
+	}
+}
+
+// messageOverrides are the command line flags that change how messages
+// are written, for the commands that write them outside the main TUI
+type messageOverrides struct {
+	Ticket      string
+	Language    string
+	SubjectOnly bool
+}
+
+func messageOverridesFromFlags(cmd *cobra.Command) messageOverrides {
+	var overrides messageOverrides
+	overrides.Ticket, _ = cmd.Flags().GetString("ticket")
+	overrides.Language, _ = cmd.Flags().GetString("language")
+	overrides.SubjectOnly, _ = cmd.Flags().GetBool("subject-only")
+	return overrides
+}
+
+func (o messageOverrides) apply(config RepoConfig) RepoConfig {
+	if o.SubjectOnly {
+		config.Lint.SubjectOnly = true
+	}
+	return config
+}
+
+// loadRepoConfig reads the config of the current repository on top of the
+// defaults, so a file only needs the settings it changes. Outside a
+// repository or without a file the defaults are used.
+func loadRepoConfig() (RepoConfig, error) {
+	config := defaultRepoConfig()
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return config, nil
+	}
+	content, err := os.ReadFile(filepath.Join(root, repoConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	// json decodes into the existing elements of a slice, which would mix a
+	// configured gitmoji set with the canonical one
+	config.Lint.Gitmojis = nil
+	config.Ticket.Placement = ""
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("could not read %s: %w", repoConfigFile, err)
+	}
+	if config.Ticket.Placement == "" {
+		config.Ticket.Placement = "none"
+		if len(config.Ticket.BranchPatterns) > 0 {
+			config.Ticket.Placement = "trailer"
+		}
+	}
+	if config.Lint.Gitmojis == nil {
+		config.Lint.Gitmojis = append([]Gitmoji{}, canonicalGitmojis...)
+	}
+	for _, pattern := range config.Ticket.BranchPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return config, fmt.Errorf("%s: invalid branch pattern %q: %w", repoConfigFile, pattern, err)
+		}
+	}
+	if config.Lint.RequireTicket && len(config.Ticket.BranchPatterns) == 0 {
+		return config, fmt.Errorf("%s: require_ticket needs the ticket branch_patterns to know what a ticket looks like", repoConfigFile)
+	}
+	config.Lint.TicketPatterns = config.Ticket.BranchPatterns
+	if !StringInSlice(config.Ticket.Placement, []string{"subject", "body", "trailer", "none"}) {
+		return config, fmt.Errorf("%s: ticket placement must be subject, body, trailer or none, not %q", repoConfigFile, config.Ticket.Placement)
+	}
+	if config.Lint.Conventional && config.Lint.Style == "plain" {
+		config.Lint.Style = "conventional"
+	}
+	if !StringInSlice(config.Lint.Style, []string{"plain", "conventional", "gitmoji"}) {
+		return config, fmt.Errorf("%s: style must be plain, conventional or gitmoji, not %q", repoConfigFile, config.Lint.Style)
+	}
+	config.Lint.Conventional = config.Lint.Style == "conventional"
+	if !StringInSlice(config.Lint.GitmojiFormat, []string{"emoji", "shortcode"}) {
+		return config, fmt.Errorf("%s: gitmoji_format must be emoji or shortcode, not %q", repoConfigFile, config.Lint.GitmojiFormat)
+	}
+	if config.Lint.Gitmojis, err = validateGitmojis(config.Lint.Gitmojis); err != nil {
+		return config, fmt.Errorf("%s: %w", repoConfigFile, err)
+	}
+	if err := validateScopeRules(config.Scopes.Rules); err != nil {
+		return config, fmt.Errorf("%s: %w", repoConfigFile, err)
+	}
+	for _, custom := range config.Trailers.Custom {
+		if !trailerRegex.MatchString(custom) {
+			return config, fmt.Errorf("%s: custom trailer %q is not of the form \"Key: value\"", repoConfigFile, custom)
+		}
+	}
+	return config, nil
+}
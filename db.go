@@ -102,7 +102,7 @@ func (cDB *CommitDB) InitDB() error {
 		}
 	}
 	if err := cDB._RunGooseMigration(); err != nil {
-		return err
+		return newAppError(ErrMigrationFailed, err)
 	}
 
 	if !DBExists {
@@ -146,6 +146,9 @@ func (cDB *CommitDB) GetUserSettings() (dbmodel.UserSettings, error) {
 		table.UserSettings.UseConventionalCommits,
 		table.UserSettings.DateCreated,
 		table.UserSettings.AiProvider,
+		table.UserSettings.RequestTimeoutSeconds,
+		table.UserSettings.MaxRetries,
+		table.UserSettings.Language,
 	).FROM(table.UserSettings).ORDER_BY(table.UserSettings.ID.DESC()).LIMIT(1)
 	err := stmt.Query(cDB.db, &userSettings)
 	if err != nil {
@@ -168,6 +171,9 @@ func (cDB *CommitDB) UpdateUserSettings(userSettings dbmodel.UserSettings) (sql.
 		UseConventionalCommits: existingUserSettings.UseConventionalCommits,
 		DateCreated:            existingUserSettings.DateCreated,
 		AiProvider:             existingUserSettings.AiProvider,
+		RequestTimeoutSeconds:  existingUserSettings.RequestTimeoutSeconds,
+		MaxRetries:             existingUserSettings.MaxRetries,
+		Language:               existingUserSettings.Language,
 	}
 	// combine existing and new settings
 	if userSettings.ModelSelection != nil {
@@ -182,6 +188,15 @@ func (cDB *CommitDB) UpdateUserSettings(userSettings dbmodel.UserSettings) (sql.
 	if userSettings.AiProvider != nil {
 		combinedSettings.AiProvider = userSettings.AiProvider
 	}
+	if userSettings.RequestTimeoutSeconds != nil {
+		combinedSettings.RequestTimeoutSeconds = userSettings.RequestTimeoutSeconds
+	}
+	if userSettings.MaxRetries != nil {
+		combinedSettings.MaxRetries = userSettings.MaxRetries
+	}
+	if userSettings.Language != nil {
+		combinedSettings.Language = userSettings.Language
+	}
 
 	stmt := table.UserSettings.INSERT(
 		table.UserSettings.ModelSelection,
@@ -189,6 +204,9 @@ func (cDB *CommitDB) UpdateUserSettings(userSettings dbmodel.UserSettings) (sql.
 		table.UserSettings.UseConventionalCommits,
 		table.UserSettings.DateCreated,
 		table.UserSettings.AiProvider,
+		table.UserSettings.RequestTimeoutSeconds,
+		table.UserSettings.MaxRetries,
+		table.UserSettings.Language,
 	).MODEL(combinedSettings)
 	return stmt.Exec(cDB.db)
 }
@@ -203,6 +221,10 @@ func (cDB *CommitDB) InsertDiff(diff dbmodel.Diff) (sql.Result, error) {
 		Model:              diff.Model,
 		AiProvider:         diff.AiProvider,
 		Prompts:            diff.Prompts,
+		ContextWindow:      diff.ContextWindow,
+		Tokenizer:          diff.Tokenizer,
+		ParsedDiffJSON:     diff.ParsedDiffJSON,
+		DiffContext:        diff.DiffContext,
 	}
 	deleteStmt := table.Diff.DELETE().WHERE(table.Diff.ID.EQ(jet.String("diff")))
 	_, err := deleteStmt.Exec(cDB.db)
@@ -217,6 +239,10 @@ func (cDB *CommitDB) InsertDiff(diff dbmodel.Diff) (sql.Result, error) {
 		table.Diff.Model,
 		table.Diff.AiProvider,
 		table.Diff.Prompts,
+		table.Diff.ContextWindow,
+		table.Diff.Tokenizer,
+		table.Diff.ParsedDiffJSON,
+		table.Diff.DiffContext,
 	).MODEL(diffStruct)
 	return stmt.Exec(cDB.db)
 }
@@ -231,6 +257,10 @@ func (cDB *CommitDB) GetDiff() (dbmodel.Diff, error) {
 		table.Diff.Model,
 		table.Diff.AiProvider,
 		table.Diff.Prompts,
+		table.Diff.ContextWindow,
+		table.Diff.Tokenizer,
+		table.Diff.ParsedDiffJSON,
+		table.Diff.DiffContext,
 	).FROM(table.Diff).WHERE(table.Diff.ID.EQ(jet.String("diff")))
 	err := stmt.Query(cDB.db, &diff)
 	if err != nil {
@@ -239,6 +269,39 @@ func (cDB *CommitDB) GetDiff() (dbmodel.Diff, error) {
 	return diff, nil
 }
 
+func (cDB *CommitDB) GetModelCatalog() ([]dbmodel.ModelCatalog, error) {
+	var models []dbmodel.ModelCatalog
+	stmt := table.ModelCatalog.SELECT(
+		table.ModelCatalog.AllColumns,
+	).FROM(table.ModelCatalog).ORDER_BY(table.ModelCatalog.Provider, table.ModelCatalog.Name)
+	err := stmt.Query(cDB.db, &models)
+	if err != nil {
+		return models, err
+	}
+	return models, nil
+}
+
+// UpsertModel stores a catalog entry, replacing any existing entry with the
+// same provider and name.
+func (cDB *CommitDB) UpsertModel(model dbmodel.ModelCatalog) (sql.Result, error) {
+	stmt := table.ModelCatalog.INSERT(
+		table.ModelCatalog.MutableColumns,
+	).MODEL(model).ON_CONFLICT(
+		table.ModelCatalog.Provider,
+		table.ModelCatalog.Name,
+	).DO_UPDATE(jet.SET(
+		table.ModelCatalog.ContextWindow.SET(table.ModelCatalog.EXCLUDED.ContextWindow),
+		table.ModelCatalog.MaxOutputTokens.SET(table.ModelCatalog.EXCLUDED.MaxOutputTokens),
+		table.ModelCatalog.Tokenizer.SET(table.ModelCatalog.EXCLUDED.Tokenizer),
+		table.ModelCatalog.InputPricePer1k.SET(table.ModelCatalog.EXCLUDED.InputPricePer1k),
+		table.ModelCatalog.OutputPricePer1k.SET(table.ModelCatalog.EXCLUDED.OutputPricePer1k),
+		table.ModelCatalog.SupportsStreaming.SET(table.ModelCatalog.EXCLUDED.SupportsStreaming),
+		table.ModelCatalog.SupportsTools.SET(table.ModelCatalog.EXCLUDED.SupportsTools),
+		table.ModelCatalog.Source.SET(table.ModelCatalog.EXCLUDED.Source),
+	))
+	return stmt.Exec(cDB.db)
+}
+
 // func test(db *sql.DB) {
 // 	CommitMessage := "Initial commit"
 // 	GitDiffCommand := "git diff HEAD"
@@ -272,3 +335,168 @@ func (cDB *CommitDB) GetDiff() (dbmodel.Diff, error) {
 // 	// println(string(jsonText))
 
 // }
+
+// GetCommitClassifications returns the cached changelog classifications for
+// the given commits
+func (cDB *CommitDB) GetCommitClassifications(shas []string) ([]dbmodel.CommitClassification, error) {
+	var classifications []dbmodel.CommitClassification
+	if len(shas) == 0 {
+		return classifications, nil
+	}
+	var shaExpressions []jet.Expression
+	for _, sha := range shas {
+		shaExpressions = append(shaExpressions, jet.String(sha))
+	}
+	stmt := table.CommitClassification.SELECT(
+		table.CommitClassification.AllColumns,
+	).FROM(table.CommitClassification).WHERE(table.CommitClassification.Sha.IN(shaExpressions...))
+	err := stmt.Query(cDB.db, &classifications)
+	if err != nil {
+		return classifications, err
+	}
+	return classifications, nil
+}
+
+func (cDB *CommitDB) UpsertCommitClassification(classification dbmodel.CommitClassification) (sql.Result, error) {
+	stmt := table.CommitClassification.INSERT(
+		table.CommitClassification.AllColumns,
+	).MODEL(classification).ON_CONFLICT(
+		table.CommitClassification.Sha,
+	).DO_UPDATE(jet.SET(
+		table.CommitClassification.Section.SET(table.CommitClassification.EXCLUDED.Section),
+		table.CommitClassification.Entry.SET(table.CommitClassification.EXCLUDED.Entry),
+		table.CommitClassification.Breaking.SET(table.CommitClassification.EXCLUDED.Breaking),
+		table.CommitClassification.Model.SET(table.CommitClassification.EXCLUDED.Model),
+		table.CommitClassification.DateCreated.SET(table.CommitClassification.EXCLUDED.DateCreated),
+	))
+	return stmt.Exec(cDB.db)
+}
+
+// InsertCommit records a commit made by aicommit
+func (cDB *CommitDB) InsertCommit(commit dbmodel.Commits) (sql.Result, error) {
+	stmt := table.Commits.INSERT(
+		table.Commits.MutableColumns,
+	).MODEL(commit)
+	return stmt.Exec(cDB.db)
+}
+
+// GetCommits lists the recorded commits and generated messages, newest first
+func (cDB *CommitDB) GetCommits(limit int64) ([]dbmodel.Commits, error) {
+	var commits []dbmodel.Commits
+	stmt := table.Commits.SELECT(
+		table.Commits.AllColumns,
+	).FROM(table.Commits).ORDER_BY(table.Commits.ID.DESC()).LIMIT(limit)
+	err := stmt.Query(cDB.db, &commits)
+	if err != nil {
+		return commits, err
+	}
+	return commits, nil
+}
+
+func (cDB *CommitDB) GetTeamMembers() ([]dbmodel.TeamMember, error) {
+	var members []dbmodel.TeamMember
+	stmt := table.TeamMember.SELECT(
+		table.TeamMember.AllColumns,
+	).FROM(table.TeamMember).ORDER_BY(table.TeamMember.Name)
+	err := stmt.Query(cDB.db, &members)
+	if err != nil {
+		return members, err
+	}
+	return members, nil
+}
+
+// UpsertTeamMember adds someone to the co-author roster. Members are keyed by
+// email, so adding an existing email updates the name.
+func (cDB *CommitDB) UpsertTeamMember(member dbmodel.TeamMember) (sql.Result, error) {
+	stmt := table.TeamMember.INSERT(
+		table.TeamMember.MutableColumns,
+	).MODEL(member).ON_CONFLICT(
+		table.TeamMember.Email,
+	).DO_UPDATE(jet.SET(
+		table.TeamMember.Name.SET(table.TeamMember.EXCLUDED.Name),
+	))
+	return stmt.Exec(cDB.db)
+}
+
+func (cDB *CommitDB) DeleteTeamMember(email string) (sql.Result, error) {
+	stmt := table.TeamMember.DELETE().WHERE(table.TeamMember.Email.EQ(jet.String(email)))
+	return stmt.Exec(cDB.db)
+}
+
+// GetCommitExplanation returns the cached explanation of a commit at the
+// given depth, if there is one
+func (cDB *CommitDB) GetCommitExplanation(sha string, depth string) (dbmodel.CommitExplanation, bool, error) {
+	var explanations []dbmodel.CommitExplanation
+	stmt := table.CommitExplanation.SELECT(
+		table.CommitExplanation.AllColumns,
+	).FROM(table.CommitExplanation).WHERE(
+		table.CommitExplanation.Sha.EQ(jet.String(sha)).AND(table.CommitExplanation.Depth.EQ(jet.String(depth))),
+	)
+	err := stmt.Query(cDB.db, &explanations)
+	if err != nil || len(explanations) == 0 {
+		return dbmodel.CommitExplanation{}, false, err
+	}
+	return explanations[0], true, nil
+}
+
+func (cDB *CommitDB) UpsertCommitExplanation(explanation dbmodel.CommitExplanation) (sql.Result, error) {
+	stmt := table.CommitExplanation.INSERT(
+		table.CommitExplanation.AllColumns,
+	).MODEL(explanation).ON_CONFLICT(
+		table.CommitExplanation.Sha,
+		table.CommitExplanation.Depth,
+	).DO_UPDATE(jet.SET(
+		table.CommitExplanation.Explanation.SET(table.CommitExplanation.EXCLUDED.Explanation),
+		table.CommitExplanation.Model.SET(table.CommitExplanation.EXCLUDED.Model),
+		table.CommitExplanation.DateCreated.SET(table.CommitExplanation.EXCLUDED.DateCreated),
+	))
+	return stmt.Exec(cDB.db)
+}
+
+// GetEmbeddingModels lists the models the history has been indexed with
+func (cDB *CommitDB) GetEmbeddingModels() ([]string, error) {
+	var rows []dbmodel.CommitEmbedding
+	stmt := table.CommitEmbedding.SELECT(
+		table.CommitEmbedding.Model,
+	).DISTINCT().FROM(table.CommitEmbedding).ORDER_BY(table.CommitEmbedding.Model)
+	if err := stmt.Query(cDB.db, &rows); err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, row := range rows {
+		models = append(models, *row.Model)
+	}
+	return models, nil
+}
+
+// GetCommitEmbeddings returns every commit indexed with the given model
+func (cDB *CommitDB) GetCommitEmbeddings(model string) ([]dbmodel.CommitEmbedding, error) {
+	var embeddings []dbmodel.CommitEmbedding
+	stmt := table.CommitEmbedding.SELECT(
+		table.CommitEmbedding.AllColumns,
+	).FROM(table.CommitEmbedding).WHERE(table.CommitEmbedding.Model.EQ(jet.String(model)))
+	err := stmt.Query(cDB.db, &embeddings)
+	if err != nil {
+		return embeddings, err
+	}
+	return embeddings, nil
+}
+
+func (cDB *CommitDB) UpsertCommitEmbedding(embedding dbmodel.CommitEmbedding) (sql.Result, error) {
+	stmt := table.CommitEmbedding.INSERT(
+		table.CommitEmbedding.AllColumns,
+	).MODEL(embedding).ON_CONFLICT(
+		table.CommitEmbedding.Sha,
+		table.CommitEmbedding.Model,
+	).DO_UPDATE(jet.SET(
+		table.CommitEmbedding.Message.SET(table.CommitEmbedding.EXCLUDED.Message),
+		table.CommitEmbedding.Vector.SET(table.CommitEmbedding.EXCLUDED.Vector),
+		table.CommitEmbedding.DateCreated.SET(table.CommitEmbedding.EXCLUDED.DateCreated),
+	))
+	return stmt.Exec(cDB.db)
+}
+
+func (cDB *CommitDB) DeleteCommitEmbeddings(model string) (sql.Result, error) {
+	stmt := table.CommitEmbedding.DELETE().WHERE(table.CommitEmbedding.Model.EQ(jet.String(model)))
+	return stmt.Exec(cDB.db)
+}
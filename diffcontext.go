@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/phuslu/log"
+)
+
+// maxDiffTokens caps the diff for models with a large context window too.
+// Past a few thousand tokens, more context costs more without making the
+// message any better.
+const maxDiffTokens = 12000
+
+// smallHunkLines is how many lines a hunk may change and still grow to its
+// whole enclosing function when the diff as a whole is too big for that
+const smallHunkLines = 20
+
+// contextLevels are tried from most to least context until the diff fits
+var contextLevels = []int{10, 6, 3, 1, 0}
+
+// diffContext is how much context around the hunks a diff was taken with
+type diffContext struct {
+	Lines         int  // git's -U
+	Function      bool // git's --function-context, for every file
+	FunctionFiles int  // files grown to whole functions on top of Lines
+	Files         int
+	Tokens        int // the estimated size of the diff
+	Budget        int // 0 when the context was fixed
+}
+
+// defaultDiffContext is used where the diff has to stay as git printed it,
+// e.g. when hunks are selected and applied again
+var defaultDiffContext = diffContext{Lines: 10}
+
+func (c diffContext) flag() string {
+	if c.Function {
+		return "--function-context"
+	}
+	return fmt.Sprintf("-U%d", c.Lines)
+}
+
+// Command is the git command that produced the diff
+func (c diffContext) Command(args ...string) string {
+	return "git " + strings.Join(append([]string{"diff", c.flag()}, args...), " ")
+}
+
+func (c diffContext) String() string {
+	description := c.flag()
+	if c.FunctionFiles > 0 {
+		description += fmt.Sprintf(", whole functions in %d of %d files", c.FunctionFiles, c.Files)
+	}
+	if c.Budget > 0 {
+		description += fmt.Sprintf(", about %d of %d tokens", c.Tokens, c.Budget)
+	}
+	return description
+}
+
+// estimateTokens is a rough count for choosing the context. The chunker
+// counts exactly with the model's tokenizer later.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// diffTokenBudget leaves half of the context window for the prompts and
+// the answer
+func diffTokenBudget(modelInfo ModelInfo) int {
+	contextWindow := modelInfo.ContextWindow
+	if contextWindow <= 0 {
+		contextWindow = defaultContextWindow
+	}
+	return min(contextWindow/2, maxDiffTokens)
+}
+
+func diffWith(flag string, args []string) (string, error) {
+	return runGitRaw("", append([]string{"diff", flag}, args...)...)
+}
+
+// contextDiff runs git diff with as much context as fits the token budget.
+// A diff that fits with whole functions gets them. Otherwise the context is
+// cut step by step towards -U0, and files with only small hunks still grow
+// to their whole functions while the budget allows. Functions are found by
+// git's funcname rules, so diff drivers set in .gitattributes are used.
+// Without a budget the context is fixed at -U10.
+func contextDiff(budget int, args ...string) (string, diffContext, error) {
+	if budget <= 0 {
+		diff, err := diffWith(defaultDiffContext.flag(), args)
+		c := defaultDiffContext
+		c.Tokens = estimateTokens(diff)
+		return diff, c, err
+	}
+
+	function, err := diffWith("--function-context", args)
+	if err != nil {
+		return "", diffContext{}, err
+	}
+	c := diffContext{Function: true, Tokens: estimateTokens(function), Budget: budget}
+	if c.Tokens <= budget {
+		log.Debug().Str("context", c.String()).Msg("chose the diff context")
+		return function, c, nil
+	}
+
+	// If nothing fits, the smallest diff is taken and the chunker splits it.
+	// That isn't always -U0: when most lines changed, whole functions can
+	// come out smaller than many separate hunks.
+	diff := function
+	for _, lines := range contextLevels {
+		candidate, err := diffWith(fmt.Sprintf("-U%d", lines), args)
+		if err != nil {
+			return "", diffContext{}, err
+		}
+		tokens := estimateTokens(candidate)
+		if tokens <= c.Tokens || tokens <= budget {
+			diff, c = candidate, diffContext{Lines: lines, Tokens: tokens, Budget: budget}
+		}
+		if tokens <= budget {
+			break
+		}
+	}
+	if !c.Function {
+		diff, c = growSmallHunks(diff, function, c)
+	}
+	log.Debug().Str("context", c.String()).Msg("chose the diff context")
+	return diff, c, nil
+}
+
+// growSmallHunks swaps in the whole-function version of files whose hunks
+// are all small, cheapest first, for as long as the diff stays within the
+// budget. Files are spliced as git printed them.
+func growSmallHunks(diff string, function string, c diffContext) (string, diffContext) {
+	files := ParseGitDiff(diff)
+	grown := ParseGitDiff(function)
+	texts := splitFileDiffs(diff)
+	grownTexts := splitFileDiffs(function)
+	c.Files = len(files)
+	if len(files) != len(grown) || len(texts) != len(files) || len(grownTexts) != len(grown) || c.Tokens >= c.Budget {
+		return diff, c
+	}
+
+	type growth struct {
+		index int
+		text  string
+		extra int
+	}
+	var growths []growth
+	for i, file := range files {
+		if file.Path() != grown[i].Path() || len(file.Hunks) == 0 || !hasOnlySmallHunks(file) {
+			continue
+		}
+		if extra := estimateTokens(grownTexts[i]) - estimateTokens(texts[i]); extra > 0 {
+			growths = append(growths, growth{index: i, text: grownTexts[i], extra: extra})
+		}
+	}
+	sort.SliceStable(growths, func(i, j int) bool {
+		return growths[i].extra < growths[j].extra
+	})
+
+	tokens := c.Tokens
+	for _, g := range growths {
+		if tokens+g.extra > c.Budget {
+			break
+		}
+		texts[g.index] = g.text
+		tokens += g.extra
+		c.FunctionFiles++
+	}
+	if c.FunctionFiles == 0 {
+		return diff, c
+	}
+	c.Tokens = tokens
+	return strings.Join(texts, ""), c
+}
+
+func hasOnlySmallHunks(file FileDiff) bool {
+	for _, hunk := range file.Hunks {
+		if hunk.Added+hunk.Removed > smallHunkLines {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFileDiffs cuts a diff into the text of each file, starting at its
+// "diff --git" line
+func splitFileDiffs(diff string) []string {
+	var starts []int
+	for i := 0; i < len(diff); {
+		if strings.HasPrefix(diff[i:], "diff --git ") {
+			starts = append(starts, i)
+		}
+		next := strings.IndexByte(diff[i:], '\n')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	texts := make([]string, len(starts))
+	for k, start := range starts {
+		end := len(diff)
+		if k+1 < len(starts) {
+			end = starts[k+1]
+		}
+		texts[k] = diff[start:end]
+	}
+	return texts
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/phuslu/log"
+	"github.com/spf13/cobra"
+	"github.com/tmc/langchaingo/llms/openai"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const (
+	// localEmbeddingModel hashes the words of a diff instead of asking the
+	// provider. It is free and works offline, but only finds commits that
+	// touch the same files and identifiers.
+	localEmbeddingModel      = "local"
+	defaultEmbeddingModel    = "text-embedding-3-small"
+	localEmbeddingDimensions = 1024
+	// maxEmbeddingChars keeps a diff well below the embedding models' input
+	// limit. The start of a condensed diff names every file, which is what
+	// tells changes apart the most.
+	maxEmbeddingChars  = 8000
+	embeddingBatchSize = 32
+	similarCommitCount = 3
+)
+
+const similarCommitsPrompt = "\nEarlier commits in this repository made similar changes. Follow their wording and conventions where they fit, but describe this change, not theirs:\n"
+
+var embeddingWordRegex = regexp.MustCompile(`[A-Za-z][A-Za-z0-9]*`)
+
+// similarCommit is an earlier commit whose diff resembles the current one
+type similarCommit struct {
+	SHA        string
+	Message    string
+	Similarity float64
+}
+
+// embeddingText is the part of a diff that is embedded: the condensed diff,
+// so lockfiles and generated code don't drown out the actual change
+func embeddingText(diff string) string {
+	text := strings.TrimSpace(CondenseDiff(ParseGitDiff(diff)).String())
+	if len(text) > maxEmbeddingChars {
+		text = strings.ToValidUTF8(text[:maxEmbeddingChars], "")
+	}
+	return text
+}
+
+// splitIdentifier breaks camelCase and snake_case names into their words
+func splitIdentifier(word string) []string {
+	var parts []string
+	start := 0
+	runes := []rune(word)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
+
+// localEmbedding hashes the words and identifiers of a text into a fixed
+// number of dimensions. Repeated words count less than new ones.
+func localEmbedding(text string) []float32 {
+	counts := map[string]int{}
+	for _, word := range embeddingWordRegex.FindAllString(text, -1) {
+		lower := strings.ToLower(word)
+		counts[lower]++
+		if parts := splitIdentifier(word); len(parts) > 1 {
+			for _, part := range parts {
+				counts[strings.ToLower(part)]++
+			}
+		}
+	}
+	vector := make([]float32, localEmbeddingDimensions)
+	for word, count := range counts {
+		if len(word) < 2 {
+			continue
+		}
+		hash := fnv.New64a()
+		hash.Write([]byte(word))
+		sum := hash.Sum64()
+		weight := float32(1 + math.Log(float64(count)))
+		// The sign bit keeps words that share a dimension from adding up
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%localEmbeddingDimensions] += weight
+	}
+	return normalizeVector(vector)
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+func cosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// encodeVector stores a vector as little-endian float32s
+func encodeVector(vector []float32) []byte {
+	encoded := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(encoded[4*i:], math.Float32bits(v))
+	}
+	return encoded
+}
+
+func decodeVector(encoded []byte) []float32 {
+	vector := make([]float32, len(encoded)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(encoded[4*i:]))
+	}
+	return vector
+}
+
+// Embed turns texts into vectors with the given embedding model. The local
+// model doesn't need a client.
+func (c *llmClient) Embed(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if model == localEmbeddingModel {
+		vectors := make([][]float32, len(texts))
+		for i, text := range texts {
+			vectors[i] = localEmbedding(text)
+		}
+		return vectors, nil
+	}
+	if c == nil {
+		return nil, fmt.Errorf("embedding model %q needs an AI provider, run `aicommit` first to pick one", model)
+	}
+	if c.provider != "openai" {
+		return nil, fmt.Errorf("provider %q is not supported", c.provider)
+	}
+	llm, err := openai.New(
+		openai.WithModel(model),
+		openai.WithToken(c.apiKey),
+		openai.WithHTTPClient(newRetryingDoer(c.limits, c.onRetry)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := llm.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, classifyProviderError(err)
+	}
+	return vectors, nil
+}
+
+// retrievalModel picks which index to search. The provider's embeddings are
+// better than the local ones, so they win when both exist and there is a
+// client to embed the query with.
+func retrievalModel(models []string, client *llmClient) (string, bool) {
+	local := false
+	for _, model := range models {
+		if model == localEmbeddingModel {
+			local = true
+		} else if client != nil {
+			return model, true
+		}
+	}
+	return localEmbeddingModel, local
+}
+
+// similarCommits returns the indexed commits whose diffs are most like the
+// given one, most similar first. Without an index there are none.
+func similarCommits(ctx context.Context, cdb *CommitDB, client *llmClient, diff string, exclude string) ([]similarCommit, error) {
+	models, err := cdb.GetEmbeddingModels()
+	if err != nil {
+		return nil, err
+	}
+	model, ok := retrievalModel(models, client)
+	if !ok {
+		return nil, nil
+	}
+	text := embeddingText(diff)
+	if text == "" {
+		return nil, nil
+	}
+	rows, err := cdb.GetCommitEmbeddings(model)
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := client.Embed(ctx, model, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	var similar []similarCommit
+	for _, row := range rows {
+		if *row.Sha == exclude || row.Message == nil {
+			continue
+		}
+		similarity := cosineSimilarity(vectors[0], decodeVector(row.Vector))
+		if similarity <= 0 {
+			continue
+		}
+		similar = append(similar, similarCommit{SHA: *row.Sha, Message: *row.Message, Similarity: similarity})
+	}
+	sort.SliceStable(similar, func(i, j int) bool {
+		return similar[i].Similarity > similar[j].Similarity
+	})
+	if len(similar) > similarCommitCount {
+		similar = similar[:similarCommitCount]
+	}
+	return similar, nil
+}
+
+// similarPrompt shows the similar commits' messages as examples
+func similarPrompt(similar []similarCommit) string {
+	if len(similar) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(similarCommitsPrompt)
+	for _, commit := range similar {
+		b.WriteString("\n---\n" + commit.Message + "\n")
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// indexCommits embeds the commits that aren't indexed with the model yet
+// and returns how many it added
+func indexCommits(ctx context.Context, cdb *CommitDB, client *llmClient, model string, commits []gitCommit, progress func(done int, total int)) (int, error) {
+	indexed, err := cdb.GetCommitEmbeddings(model)
+	if err != nil {
+		return 0, err
+	}
+	known := map[string]bool{}
+	for _, row := range indexed {
+		known[*row.Sha] = true
+	}
+	var pending []gitCommit
+	for _, commit := range commits {
+		if !known[commit.SHA] {
+			pending = append(pending, commit)
+		}
+	}
+
+	added := 0
+	for start := 0; start < len(pending); start += embeddingBatchSize {
+		batch := pending[start:min(start+embeddingBatchSize, len(pending))]
+		var texts []string
+		var embedded []gitCommit
+		for _, commit := range batch {
+			diff, err := commitDiff(commit.SHA)
+			if err != nil {
+				return added, err
+			}
+			// Empty commits have nothing to compare against
+			if text := embeddingText(diff); text != "" {
+				texts = append(texts, text)
+				embedded = append(embedded, commit)
+			}
+		}
+		if len(texts) > 0 {
+			vectors, err := client.Embed(ctx, model, texts)
+			if err != nil {
+				return added, err
+			}
+			dateCreated := time.Now()
+			for i, commit := range embedded {
+				message := strings.TrimSpace(commit.Subject + "\n\n" + commit.Body)
+				if _, err := cdb.UpsertCommitEmbedding(dbmodel.CommitEmbedding{
+					Sha:         &commit.SHA,
+					Model:       &model,
+					Message:     &message,
+					Vector:      encodeVector(vectors[i]),
+					DateCreated: &dateCreated,
+				}); err != nil {
+					return added, err
+				}
+				added++
+			}
+		}
+		progress(start+len(batch), len(pending))
+	}
+	return added, nil
+}
+
+// ---------------- CLI ----------------
+
+func newIndexCmd(cdb *CommitDB) *cobra.Command {
+	var model string
+	var local bool
+	var maxCommits int
+	var rebuild bool
+	cmdIndex := &cobra.Command{
+		Use:   "index",
+		Short: "Index the commit history so new messages can follow similar earlier commits",
+		Long: "Embeds the diffs of past commits and stores the vectors in aicommit.db. When a message is generated, the messages of the most similar commits are given to the model as examples. " +
+			"Only commits that aren't indexed yet are embedded, so run it again from time to time to pick up new ones. " +
+			"--local hashes the words of each diff instead of calling the provider's embeddings API.",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if local {
+				model = localEmbeddingModel
+			}
+			var client *llmClient
+			if model != localEmbeddingModel {
+				var err error
+				client, err = loadLLMClient(cdb)
+				if err != nil {
+					showFatalError(err)
+					return err
+				}
+				client.onRetry = func(status RetryStatus) {
+					fmt.Fprintln(os.Stderr, status.String())
+				}
+			}
+			if rebuild {
+				if _, err := cdb.DeleteCommitEmbeddings(model); err != nil {
+					showFatalError(err)
+					return err
+				}
+			}
+
+			commits, err := logCommits("HEAD", "--no-merges", fmt.Sprintf("--max-count=%d", maxCommits))
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			added, err := indexCommits(cmd.Context(), cdb, client, model, commits, func(done int, total int) {
+				fmt.Fprintf(os.Stderr, "Indexed %d of %d commits\n", done, total)
+			})
+			if err != nil {
+				log.Error().Err(err).Int("added", added).Msg("indexing stopped")
+				showFatalError(err)
+				return err
+			}
+			fmt.Printf("Added %d commits to the %s index\n", added, model)
+			return nil
+		},
+	}
+	cmdIndex.Flags().StringVar(&model, "model", defaultEmbeddingModel, "the provider's embedding model")
+	cmdIndex.Flags().BoolVar(&local, "local", false, "use local word hashing instead of the provider's embeddings")
+	cmdIndex.Flags().IntVar(&maxCommits, "max", 1000, "how many of the latest commits to index")
+	cmdIndex.Flags().BoolVar(&rebuild, "rebuild", false, "drop the model's index and embed everything again")
+	cmdIndex.MarkFlagsMutuallyExclusive("model", "local")
+	return cmdIndex
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+type ErrorKind int
+
+const (
+	ErrUnexpected ErrorKind = iota
+	ErrNotARepo
+	ErrNoChanges
+	ErrAuthFailed
+	ErrRateLimited
+	ErrContextOverflow
+	ErrKeyringUnavailable
+	ErrMigrationFailed
+)
+
+// ErrorAction is the shortcut the error view offers for getting unstuck.
+type ErrorAction int
+
+const (
+	ActionNone ErrorAction = iota
+	ActionRetry
+	ActionSettings
+)
+
+// AppError is a failure we know how to explain to the user.
+type AppError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func newAppError(kind ErrorKind, err error) *AppError {
+	return &AppError{Kind: kind, Err: err}
+}
+
+func (e *AppError) Error() string {
+	return e.Title() + ": " + e.Err.Error()
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Is lets callers match on the kind alone, e.g. errors.Is(err, &AppError{Kind: ErrNoChanges}).
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	return ok && t.Kind == e.Kind
+}
+
+func (e *AppError) Title() string {
+	switch e.Kind {
+	case ErrNotARepo:
+		return "Not a git repository"
+	case ErrNoChanges:
+		return "No changes to describe"
+	case ErrAuthFailed:
+		return "Authentication failed"
+	case ErrRateLimited:
+		return "Rate limited"
+	case ErrContextOverflow:
+		return "Diff too large for the model"
+	case ErrKeyringUnavailable:
+		return "Keyring unavailable"
+	case ErrMigrationFailed:
+		return "Database migration failed"
+	}
+	return "Something went wrong"
+}
+
+// Fix suggests what the user can do about the error.
+func (e *AppError) Fix() string {
+	switch e.Kind {
+	case ErrNotARepo:
+		return "Run aicommit from inside a git working tree."
+	case ErrNoChanges:
+		return "Make or stage some changes, then try again."
+	case ErrAuthFailed:
+		return "Your API key was rejected. Enter a new one in the settings."
+	case ErrRateLimited:
+		return "The provider is still rate limiting after several retries. Wait a moment and try again, or pick another model."
+	case ErrContextOverflow:
+		return "Pick a model with a larger context window, or exclude large generated files from the diff."
+	case ErrKeyringUnavailable:
+		return "No system keyring could be reached. On Linux make sure a Secret Service provider such as gnome-keyring is running."
+	case ErrMigrationFailed:
+		return "The local database could not be upgraded. Move aicommit.db out of the way and start again."
+	}
+	return "Run again with LOG_LEVEL=debug for details."
+}
+
+func (e *AppError) Action() ErrorAction {
+	switch e.Kind {
+	case ErrAuthFailed, ErrContextOverflow:
+		return ActionSettings
+	case ErrMigrationFailed:
+		return ActionNone
+	}
+	return ActionRetry
+}
+
+// asAppError returns err as an *AppError, wrapping unknown errors as
+// unexpected ones.
+func asAppError(err error) *AppError {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return newAppError(ErrUnexpected, err)
+}
+
+// classifyGitError recognises git failing because we aren't in a repository.
+func classifyGitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "not a git repository") {
+		return newAppError(ErrNotARepo, err)
+	}
+	return err
+}
+
+// classifyProviderError maps the provider client's errors, which only carry
+// the HTTP status in their text, onto error kinds.
+func classifyProviderError(err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "status code: 401"), strings.Contains(msg, "status code: 403"):
+		return newAppError(ErrAuthFailed, err)
+	case strings.Contains(msg, "status code: 429"):
+		return newAppError(ErrRateLimited, err)
+	case strings.Contains(msg, "context_length_exceeded"), strings.Contains(msg, "maximum context length"):
+		return newAppError(ErrContextOverflow, err)
+	}
+	return err
+}
+
+// classifyKeyringError treats everything except a missing entry as the
+// keyring itself being unavailable.
+func classifyKeyringError(err error) error {
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return newAppError(ErrKeyringUnavailable, err)
+}
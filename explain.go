@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/phuslu/log"
+	"github.com/spf13/cobra"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const explainPrompt = `You explain an existing git commit to a developer who is new to the codebase. You get the commit message and its changes, either as a diff or as summaries of parts of the diff.
+Say in plain English what changed and why. Don't go through the diff line by line. When the reason isn't stated anywhere, give the most likely one and say that it is a guess.
+Write plain text without Markdown headings or bold text.
+`
+
+const explainChunkPrompt = "Summarise this part of a commit's diff in a few short bullet points. Only describe what changed."
+
+// explainDepths are the levels of detail of an explanation
+var explainDepths = map[string]string{
+	"summary":  "Answer in one short paragraph of at most four sentences.",
+	"detailed": "Start with a short overview, then go through the changes area by area with - bullets, and end with anything that is easy to miss, such as behaviour changes or follow-up work.",
+}
+
+// explainDiff is the diff a commit introduced. Merges are compared with
+// their first parent, which is what they brought into the branch.
+func explainDiff(sha string) (string, error) {
+	parents, err := runGit("rev-list", "--parents", "--max-count=1", sha)
+	if err != nil {
+		return "", err
+	}
+	if len(strings.Fields(parents)) > 2 {
+		return runGitRaw("", "diff", "-U10", sha+"^1", sha)
+	}
+	return commitDiff(sha)
+}
+
+// explainCommit explains a commit, streaming the answer as it arrives.
+// Explanations are cached per commit and depth; refresh asks again anyway.
+func explainCommit(ctx context.Context, cdb *CommitDB, client *llmClient, sha string, depth string, refresh bool,
+	progress func(status string), stream func(chunk string) error) (string, bool, error) {
+	if !refresh {
+		cached, found, err := cdb.GetCommitExplanation(sha, depth)
+		if err != nil {
+			return "", false, err
+		}
+		if found && cached.Explanation != nil {
+			return *cached.Explanation, true, nil
+		}
+	}
+
+	message, err := runGit("log", "-1", "--format=%B", sha)
+	if err != nil {
+		return "", false, err
+	}
+	diff, err := explainDiff(sha)
+	if err != nil {
+		return "", false, err
+	}
+	system := explainPrompt + explainDepths[depth] + "\n"
+	catalog, err := LoadModelCatalog(cdb)
+	if err != nil {
+		return "", false, err
+	}
+	modelInfo, _ := catalog.Lookup(client.provider, client.model)
+	chunks, err := chunkDiff(cdb, diff, defaultDiffContext, CondenseDiff(ParseGitDiff(diff)), modelInfo, []string{system, explainChunkPrompt})
+	if err != nil {
+		return "", false, err
+	}
+
+	var human strings.Builder
+	fmt.Fprintf(&human, "Commit %s\n\nMessage:\n%s\n", sha, message)
+	if len(chunks) == 1 {
+		human.WriteString("\nDiff:\n" + chunkText(chunks[0]))
+	} else {
+		for i, chunk := range chunks {
+			progress(fmt.Sprintf("Summarising part %d of %d", i+1, len(chunks)))
+			summary, err := client.Complete(ctx, explainChunkPrompt, chunkText(chunk), nil)
+			if err != nil {
+				return "", false, err
+			}
+			fmt.Fprintf(&human, "\nChanges, part %d of %d:\n%s\n", i+1, len(chunks), summary)
+		}
+	}
+	progress("Explaining")
+	explanation, err := client.Complete(ctx, system, human.String(), stream)
+	if err != nil {
+		return "", false, err
+	}
+	explanation = strings.TrimSpace(stripMarkdown(explanation))
+
+	dateCreated := time.Now()
+	if _, err := cdb.UpsertCommitExplanation(dbmodel.CommitExplanation{
+		Sha:         &sha,
+		Depth:       &depth,
+		Explanation: &explanation,
+		Model:       &client.model,
+		DateCreated: &dateCreated,
+	}); err != nil {
+		log.Error().Err(err).Msg("could not cache the explanation")
+	}
+	return explanation, false, nil
+}
+
+// ---------------- TUI ----------------
+
+type explainChunkMsg struct {
+	chunk string
+}
+
+type explainDoneMsg struct {
+	explanation string
+	cached      bool
+}
+
+func waitForExplainChunk(chunks chan string) tea.Cmd {
+	return func() tea.Msg {
+		return explainChunkMsg{<-chunks}
+	}
+}
+
+type explainModel struct {
+	cdb         *CommitDB
+	client      *llmClient
+	sha         string
+	subject     string
+	depth       string
+	refresh     bool
+	explanation *strings.Builder
+	status      string
+	loading     bool
+	cached      bool
+	spinner     spinner.Model
+	progress    chan string
+	chunks      chan string
+	err         *AppError
+	ctx         context.Context
+	cancel      context.CancelFunc
+	width       int
+}
+
+func newExplainModel(cdb *CommitDB, client *llmClient, sha string, subject string, depth string, refresh bool) explainModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	return explainModel{
+		cdb:         cdb,
+		client:      client,
+		sha:         sha,
+		subject:     subject,
+		depth:       depth,
+		refresh:     refresh,
+		loading:     true,
+		explanation: &strings.Builder{},
+		spinner:     spinner.New(),
+		progress:    make(chan string),
+		chunks:      make(chan string),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+func (m explainModel) Init() tea.Cmd {
+	ctx, cdb, client, sha, depth, refresh, progress, chunks := m.ctx, m.cdb, m.client, m.sha, m.depth, m.refresh, m.progress, m.chunks
+	client.onRetry = func(status RetryStatus) {
+		select {
+		case progress <- status.String():
+		case <-ctx.Done():
+		}
+	}
+	return tea.Batch(m.spinner.Tick, waitForActivity(progress), waitForExplainChunk(chunks), func() tea.Msg {
+		explanation, cached, err := explainCommit(ctx, cdb, client, sha, depth, refresh,
+			func(status string) {
+				select {
+				case progress <- status:
+				case <-ctx.Done():
+				}
+			},
+			func(chunk string) error {
+				select {
+				case chunks <- chunk:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		if err != nil {
+			return errMsg{err}
+		}
+		return explainDoneMsg{explanation: explanation, cached: cached}
+	})
+}
+
+func (m explainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancel()
+			return m, tea.Quit
+		}
+	case spinner.TickMsg:
+		if m.loading {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+	case responseMsg:
+		m.status = msg.messageContent
+		return m, waitForActivity(m.progress)
+	case explainChunkMsg:
+		m.explanation.WriteString(msg.chunk)
+		return m, waitForExplainChunk(m.chunks)
+	case explainDoneMsg:
+		m.loading = false
+		m.cached = msg.cached
+		m.explanation.Reset()
+		m.explanation.WriteString(msg.explanation)
+	case errMsg:
+		m.loading = false
+		m.err = asAppError(msg.err)
+	}
+	return m, nil
+}
+
+func (m explainModel) View() string {
+	if m.err != nil {
+		return renderError(m.err, []string{"q quit"}, m.width)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n %s %s\n\n", shortSHA(m.sha), m.subject)
+	if m.loading {
+		fmt.Fprintf(&b, " %s %s\n\n", m.spinner.View(), m.status)
+	}
+	if m.explanation.Len() > 0 {
+		b.WriteString(m.explanation.String() + "\n\n")
+	}
+	help := "q quit"
+	if m.cached {
+		help = "cached, use --refresh to ask again • " + help
+	}
+	b.WriteString(" " + helpStyle.Render(help) + "\n")
+	return mainContentStyle.Width(m.width).Render(b.String())
+}
+
+// ---------------- CLI ----------------
+
+func newExplainCmd(cdb *CommitDB) *cobra.Command {
+	var depth string
+	var refresh bool
+	cmdExplain := &cobra.Command{
+		Use:   "explain <sha>",
+		Short: "Explain what an existing commit changed and why",
+		Long: "Runs the commit's message and diff through the same pipeline as new commits and explains them in plain English. " +
+			"Explanations are cached per commit and depth. On a terminal they are shown in the TUI, otherwise streamed to stdout.",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, ok := explainDepths[depth]; !ok {
+				err := fmt.Errorf("--depth must be summary or detailed, not %q", depth)
+				showFatalError(err)
+				return err
+			}
+			sha, err := runGit("rev-parse", "--verify", args[0]+"^{commit}")
+			if err != nil {
+				err = fmt.Errorf("%s is not a commit: %w", args[0], err)
+				showFatalError(err)
+				return err
+			}
+			client, err := loadLLMClient(cdb)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+
+			if log.IsTerminal(os.Stdout.Fd()) {
+				subject, _ := runGit("log", "-1", "--format=%s", sha)
+				finalModel, err := tea.NewProgram(newExplainModel(cdb, client, sha, subject, depth, refresh)).Run()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "could not start program:", err)
+					return err
+				}
+				if m, ok := finalModel.(explainModel); ok && m.err != nil {
+					return m.err
+				}
+				return nil
+			}
+
+			client.onRetry = func(status RetryStatus) {
+				fmt.Fprintln(os.Stderr, status.String())
+			}
+			explanation, cached, err := explainCommit(cmd.Context(), cdb, client, sha, depth, refresh,
+				func(status string) { fmt.Fprintln(os.Stderr, status) },
+				func(chunk string) error {
+					_, err := fmt.Print(chunk)
+					return err
+				})
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			if cached {
+				fmt.Print(explanation)
+			}
+			fmt.Println()
+			return nil
+		},
+	}
+	cmdExplain.Flags().StringVar(&depth, "depth", "summary", "how much detail to give: summary or detailed")
+	cmdExplain.Flags().BoolVar(&refresh, "refresh", false, "ask the model again instead of using the cached explanation")
+	return cmdExplain
+}
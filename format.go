@@ -0,0 +1,220 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/muesli/reflow/wordwrap"
+)
+
+// commitMessage is a message taken apart, so it can be laid out by the
+// rules instead of however the model happened to write it
+type commitMessage struct {
+	Subject string
+	Body    []messageBlock
+	Footers []string
+}
+
+// messageBlock is a paragraph, a bullet list or a verbatim block such as
+// indented code
+type messageBlock struct {
+	Text     string
+	Bullets  []string
+	Verbatim []string
+}
+
+var (
+	bulletRegex         = regexp.MustCompile(`^\s*(?:[-*+•]|\d+[.)])\s+`)
+	markdownHeaderRegex = regexp.MustCompile(`^#{1,6}\s+`)
+	markdownBoldRegex   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	subjectLabelRegex   = regexp.MustCompile(`(?i)^(?:commit message|subject|title)\s*:\s*`)
+	bodyLabelRegex      = regexp.MustCompile(`(?i)^(?:#+\s*)?(?:body|description|details)\s*:?\s*$`)
+)
+
+// stripMarkdown removes what models add out of habit: code fences,
+// headings, bold markers and labels. Fenced code is indented instead, which
+// keeps it as is. Inline code is common in commit messages and stays.
+func stripMarkdown(message string) string {
+	all := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n")
+	// The whole message in one fence is a wrapper, not code
+	if len(all) > 1 && strings.HasPrefix(all[0], "```") && strings.HasPrefix(all[len(all)-1], "```") {
+		all = all[1 : len(all)-1]
+	}
+	var lines []string
+	inFence := false
+	for _, line := range all {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			if trimmed != "" {
+				line = "    " + line
+			}
+			lines = append(lines, strings.TrimRight(line, " \t"))
+			continue
+		}
+		if bodyLabelRegex.MatchString(trimmed) {
+			continue
+		}
+		line = markdownHeaderRegex.ReplaceAllString(line, "")
+		line = markdownBoldRegex.ReplaceAllString(line, "$1")
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// isFooterParagraph tells trailers and BREAKING CHANGE footers apart from
+// prose
+func isFooterParagraph(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !trailerRegex.MatchString(line) && !breakingFooterRegex.MatchString(line) &&
+			!strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote takes off quotes the model put around the whole subject. Quotes
+// that belong to it, like in Revert "add login", stay.
+func unquote(subject string) string {
+	if len(subject) < 2 {
+		return subject
+	}
+	quote := subject[0]
+	inner := subject[1 : len(subject)-1]
+	if (quote == '"' || quote == '\'') && subject[len(subject)-1] == quote && !strings.ContainsRune(inner, rune(quote)) {
+		return inner
+	}
+	return subject
+}
+
+func parseCommitMessage(raw string) commitMessage {
+	var message commitMessage
+	text := stripMarkdown(raw)
+	subject, rest, _ := strings.Cut(text, "\n")
+	subject = subjectLabelRegex.ReplaceAllString(strings.TrimSpace(subject), "")
+	message.Subject = unquote(subject)
+
+	paragraphs := strings.Split(strings.TrimSpace(rest), "\n\n")
+	if last := strings.TrimSpace(paragraphs[len(paragraphs)-1]); last != "" && isFooterParagraph(last) {
+		message.Footers = strings.Split(last, "\n")
+		paragraphs = paragraphs[:len(paragraphs)-1]
+	}
+	for _, paragraph := range paragraphs {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		message.Body = append(message.Body, parseMessageBlock(paragraph))
+	}
+	return message
+}
+
+func parseMessageBlock(paragraph string) messageBlock {
+	lines := strings.Split(paragraph, "\n")
+	verbatim := true
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, ">") {
+			verbatim = false
+		}
+	}
+	if verbatim {
+		return messageBlock{Verbatim: lines}
+	}
+
+	var block messageBlock
+	if bulletRegex.MatchString(lines[0]) {
+		for _, line := range lines {
+			if bulletRegex.MatchString(line) {
+				block.Bullets = append(block.Bullets, bulletRegex.ReplaceAllString(line, ""))
+			} else if len(block.Bullets) > 0 {
+				// A wrapped continuation of the previous bullet
+				block.Bullets[len(block.Bullets)-1] += " " + strings.TrimSpace(line)
+			}
+		}
+		return block
+	}
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	block.Text = strings.Join(lines, " ")
+	return block
+}
+
+// wrapText wraps at spaces only, so paths and hyphenated words stay whole.
+// Words longer than the width, like URLs, get a line of their own.
+func wrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+	wrapper := wordwrap.NewWriter(width)
+	wrapper.Breakpoints = nil
+	wrapper.Write([]byte(text))
+	wrapper.Close()
+	return wrapper.String()
+}
+
+// splitSubject cuts a subject that is too long at the last word that fits
+// and returns the rest, so that nothing it says is lost. A single word that
+// is too long is left alone.
+func splitSubject(subject string, limit int) (string, string) {
+	if limit <= 1 || utf8.RuneCountInString(subject) <= limit {
+		return subject, ""
+	}
+	// One rune is left for the ellipsis
+	prefix := string([]rune(subject)[:limit])
+	cut := strings.LastIndex(prefix, " ")
+	if cut <= 0 {
+		return subject, ""
+	}
+	return strings.TrimRight(subject[:cut], " ,;:-–") + "…", "…" + strings.TrimSpace(subject[cut:])
+}
+
+// render lays the message out by the lint rules. A subject over the length
+// limit is cut at a word and continues in the body. Without a body it is
+// left whole for lint to report.
+func (message commitMessage) render(config LintConfig) string {
+	subject := message.Subject
+	if config.NoTrailingPeriod {
+		subject = strings.TrimRight(subject, ".")
+	}
+	var paragraphs []string
+	if !config.SubjectOnly {
+		var overflow string
+		subject, overflow = splitSubject(subject, config.SubjectMaxLength)
+		if overflow != "" {
+			paragraphs = append(paragraphs, wrapText(overflow, config.BodyWrap))
+		}
+		for _, block := range message.Body {
+			switch {
+			case block.Verbatim != nil:
+				paragraphs = append(paragraphs, strings.Join(block.Verbatim, "\n"))
+			case block.Bullets != nil:
+				var bullets []string
+				for _, bullet := range block.Bullets {
+					wrapped := wrapText(bullet, config.BodyWrap-2)
+					bullets = append(bullets, "- "+strings.ReplaceAll(wrapped, "\n", "\n  "))
+				}
+				paragraphs = append(paragraphs, strings.Join(bullets, "\n"))
+			default:
+				paragraphs = append(paragraphs, wrapText(block.Text, config.BodyWrap))
+			}
+		}
+	}
+	if len(message.Footers) > 0 {
+		paragraphs = append(paragraphs, strings.Join(message.Footers, "\n"))
+	}
+	if len(paragraphs) == 0 {
+		return subject
+	}
+	return subject + "\n\n" + strings.Join(paragraphs, "\n\n")
+}
+
+// formatMessage cleans up a generated message and lays it out by the rules
+func formatMessage(raw string, config LintConfig) string {
+	return parseCommitMessage(raw).render(config)
+}
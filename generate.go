@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/phuslu/log"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const regeneratePrompt = "\nA message you wrote earlier is given after the diff, and the user wants a different one. Describe the same change with different wording or emphasis.\n"
+
+// messageRequest is what a commit message is written from, whether the TUI
+// or an editor asks for it. The overrides win over the repository config.
+type messageRequest struct {
+	Diff            string
+	Context         diffContext // how much context the diff was taken with
+	CurrentMessage  string      // the message of the commit being amended
+	Previous        string      // an earlier message to write a different one than
+	Ticket          string
+	Language        string
+	ProfileLanguage string
+	SubjectOnly     bool
+	CoAuthors       []dbmodel.TeamMember
+}
+
+type generatedMessage struct {
+	Message string
+	Status  string // a note for the user, e.g. that the change spans scopes
+}
+
+// writeCommitMessage runs a diff through the whole pipeline: condensing,
+// the repository's rules, scopes and language, the Go API summary, the
+// model and the final layout with ticket and trailers. The diff is recorded
+// in the diff table.
+func writeCommitMessage(ctx context.Context, cdb *CommitDB, client *llmClient, modelInfo ModelInfo, request messageRequest, stream func(chunk string) error) (generatedMessage, error) {
+	// Lockfiles, binaries and generated code are reduced to one line each
+	files := ParseGitDiff(request.Diff)
+	condensed := CondenseDiff(files)
+
+	repoConfig, err := loadRepoConfig()
+	if err != nil {
+		return generatedMessage{}, err
+	}
+	repoConfig.Lint.SubjectOnly = repoConfig.Lint.SubjectOnly || request.SubjectOnly
+	ticket := currentTicket(repoConfig.Ticket, request.Ticket)
+	lang := messageLanguage(repoConfig, request.ProfileLanguage, request.Language)
+	scopes, err := resolveChangeScopes(repoConfig, files)
+	if err != nil {
+		return generatedMessage{}, err
+	}
+	repoConfig.Lint.Scopes = scopes.Allowed
+	api := summarizeGoAPI(files)
+	systemPrompt := commitMessageSystemPrompt(repoConfig, ticket, lang) + scopes.prompt() + api.prompt(repoConfig.Lint)
+	// When amending, the commit itself is indexed and would be the best match
+	exclude := ""
+	if request.CurrentMessage != "" {
+		exclude, _ = runGit("rev-parse", "HEAD")
+		exclude = strings.TrimSpace(exclude)
+	}
+	similar, err := similarCommits(ctx, cdb, client, request.Diff, exclude)
+	if err != nil {
+		// Examples help, but a message can be written without them
+		log.Warn().Err(err).Msg("could not look up similar commits")
+	}
+	systemPrompt += similarPrompt(similar)
+	prompt := condensed.String()
+	if request.CurrentMessage != "" {
+		systemPrompt += amendPrompt
+		prompt += "\nCurrent message:\n" + request.CurrentMessage
+	}
+	if request.Previous != "" {
+		systemPrompt += regeneratePrompt
+		prompt += "\nEarlier message:\n" + request.Previous
+	}
+
+	if _, err := chunkDiff(cdb, request.Diff, request.Context, condensed, modelInfo, []string{systemPrompt}); err != nil {
+		return generatedMessage{}, err
+	}
+
+	content, err := completeInLanguage(ctx, client, lang, systemPrompt, prompt, stream)
+	if err != nil {
+		return generatedMessage{}, err
+	}
+	content, err = finishMessage(api.markBreaking(content, repoConfig.Lint), repoConfig, ticket, request.CoAuthors)
+	if err != nil {
+		return generatedMessage{}, err
+	}
+	return generatedMessage{
+		Message: scopes.constrain(content),
+		Status:  scopes.Warning(),
+	}, nil
+}
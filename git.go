@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runGit runs git and returns its trimmed stdout. Failures carry git's
+// stderr so they can be shown to the user.
+func runGit(args ...string) (string, error) {
+	output, err := runGitRaw("", args...)
+	return strings.TrimSpace(output), err
+}
+
+// runGitRaw feeds input to git's stdin and returns stdout untouched, which
+// matters for patches where trailing newlines are significant.
+func runGitRaw(input string, args ...string) (string, error) {
+	return runGitEnv(nil, input, args...)
+}
+
+// runGitEnv is runGitRaw with extra environment variables, e.g. to keep the
+// author of a rewritten commit.
+func runGitEnv(env []string, input string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitErr.Stderr = stderr.Bytes()
+		}
+		return "", classifyGitError(fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String())))
+	}
+	return string(output), nil
+}
+
+type gitCommit struct {
+	SHA     string
+	Subject string
+	Body    string
+}
+
+// logCommits lists the commits in a revision range, oldest first. Extra
+// arguments are passed on to git log.
+func logCommits(revRange string, extra ...string) ([]gitCommit, error) {
+	args := append([]string{"log", "--reverse", "--format=%H%x1f%s%x1f%b%x1e"}, extra...)
+	out, err := runGit(append(args, revRange)...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []gitCommit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimSpace(record), "\x1f")
+		if len(fields) < 3 {
+			continue
+		}
+		commits = append(commits, gitCommit{SHA: fields[0], Subject: fields[1], Body: strings.TrimSpace(fields[2])})
+	}
+	return commits, nil
+}
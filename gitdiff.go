@@ -2,6 +2,10 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -53,6 +57,359 @@ func SplitGitDiff(diff string, length int) [][]Chunk {
 	return chunks
 }
 
+// FileStatus is what happened to a file as a whole
+type FileStatus string
+
+const (
+	FileModified FileStatus = "modified"
+	FileAdded    FileStatus = "added"
+	FileDeleted  FileStatus = "deleted"
+	FileRenamed  FileStatus = "renamed"
+	FileCopied   FileStatus = "copied"
+)
+
+// submoduleMode is the git mode of a gitlink entry
+const submoduleMode = "160000"
+
+// FileDiff is one file's section of a git diff
+type FileDiff struct {
+	OldPath     string     `json:"old_path,omitempty"` // empty for added files
+	NewPath     string     `json:"new_path,omitempty"` // empty for deleted files
+	Status      FileStatus `json:"status"`
+	OldMode     string     `json:"old_mode,omitempty"`
+	NewMode     string     `json:"new_mode,omitempty"`
+	Similarity  int        `json:"similarity,omitempty"` // percent, for renames and copies
+	OldHash     string     `json:"old_hash,omitempty"`
+	NewHash     string     `json:"new_hash,omitempty"`
+	IsBinary    bool       `json:"is_binary"`
+	IsSubmodule bool       `json:"is_submodule"`
+	Added       int        `json:"added"`
+	Removed     int        `json:"removed"`
+	Header      []string   `json:"header"` // every line before the first hunk
+	Hunks       []Hunk     `json:"hunks"`
+}
+
+// Hunk is a single @@ section of a file diff
+type Hunk struct {
+	Header   string   `json:"header"` // the @@ line as git printed it
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Section  string   `json:"section,omitempty"` // the text after the closing @@, usually the enclosing function
+	Added    int      `json:"added"`
+	Removed  int      `json:"removed"`
+	Lines    []string `json:"lines"`
+}
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+var indexLineRegex = regexp.MustCompile(`^index ([0-9a-f]+)\.\.([0-9a-f]+)(?: (\d+))?$`)
+
+// ParseGitDiff parses the output of git diff into files and hunks
+func ParseGitDiff(diff string) []FileDiff {
+	var files []FileDiff
+	var file *FileDiff
+	var hunk *Hunk
+
+	flushHunk := func() {
+		if hunk != nil {
+			file.Hunks = append(file.Hunks, *hunk)
+			file.Added += hunk.Added
+			file.Removed += hunk.Removed
+			hunk = nil
+		}
+	}
+	flush := func() {
+		if file == nil {
+			return
+		}
+		flushHunk()
+		file.finish()
+		files = append(files, *file)
+		file = nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(diff))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "diff --git ") {
+			flush()
+			file = &FileDiff{Header: []string{line}, Status: FileModified}
+			file.OldPath, file.NewPath = parseDiffGitPaths(strings.TrimPrefix(line, "diff --git "))
+			continue
+		}
+		if file == nil {
+			continue
+		}
+		if match := hunkHeaderRegex.FindStringSubmatch(line); match != nil {
+			flushHunk()
+			hunk = &Hunk{
+				Header:   line,
+				OldStart: atoiOr(match[1], 0),
+				OldLines: atoiOr(match[2], 1),
+				NewStart: atoiOr(match[3], 0),
+				NewLines: atoiOr(match[4], 1),
+				Section:  match[5],
+			}
+			continue
+		}
+		if hunk != nil {
+			hunk.Lines = append(hunk.Lines, line)
+			switch {
+			case strings.HasPrefix(line, "+"):
+				hunk.Added++
+			case strings.HasPrefix(line, "-"):
+				hunk.Removed++
+			}
+			continue
+		}
+
+		file.Header = append(file.Header, line)
+		file.parseHeaderLine(line)
+	}
+	flush()
+	return files
+}
+
+// parseHeaderLine picks up the extended header lines git prints between
+// "diff --git" and the first hunk
+func (f *FileDiff) parseHeaderLine(line string) {
+	switch {
+	case strings.HasPrefix(line, "--- "):
+		f.OldPath = parseDiffPath(strings.TrimPrefix(line, "--- "), "a/")
+	case strings.HasPrefix(line, "+++ "):
+		f.NewPath = parseDiffPath(strings.TrimPrefix(line, "+++ "), "b/")
+	case strings.HasPrefix(line, "new file mode "):
+		f.Status = FileAdded
+		f.NewMode = strings.TrimPrefix(line, "new file mode ")
+	case strings.HasPrefix(line, "deleted file mode "):
+		f.Status = FileDeleted
+		f.OldMode = strings.TrimPrefix(line, "deleted file mode ")
+	case strings.HasPrefix(line, "old mode "):
+		f.OldMode = strings.TrimPrefix(line, "old mode ")
+	case strings.HasPrefix(line, "new mode "):
+		f.NewMode = strings.TrimPrefix(line, "new mode ")
+	case strings.HasPrefix(line, "rename from "):
+		f.Status = FileRenamed
+		f.OldPath = unquoteDiffPath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		f.NewPath = unquoteDiffPath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "):
+		f.Status = FileCopied
+		f.OldPath = unquoteDiffPath(strings.TrimPrefix(line, "copy from "))
+	case strings.HasPrefix(line, "copy to "):
+		f.NewPath = unquoteDiffPath(strings.TrimPrefix(line, "copy to "))
+	case strings.HasPrefix(line, "similarity index "), strings.HasPrefix(line, "dissimilarity index "):
+		_, percent, _ := strings.Cut(line, "index ")
+		f.Similarity = atoiOr(strings.TrimSuffix(percent, "%"), 0)
+	case strings.HasPrefix(line, "Binary files "), line == "GIT binary patch":
+		f.IsBinary = true
+	default:
+		if match := indexLineRegex.FindStringSubmatch(line); match != nil {
+			f.OldHash = match[1]
+			f.NewHash = match[2]
+			if match[3] != "" {
+				f.OldMode = match[3]
+				f.NewMode = match[3]
+			}
+		}
+	}
+}
+
+// finish normalises what the header lines left behind
+func (f *FileDiff) finish() {
+	switch f.Status {
+	case FileAdded:
+		f.OldPath = ""
+	case FileDeleted:
+		f.NewPath = ""
+	}
+	if f.OldMode == submoduleMode || f.NewMode == submoduleMode {
+		f.IsSubmodule = true
+	}
+	for _, hunk := range f.Hunks {
+		for _, line := range hunk.Lines {
+			if strings.HasPrefix(line, "+Subproject commit ") || strings.HasPrefix(line, "-Subproject commit ") {
+				f.IsSubmodule = true
+			}
+		}
+	}
+}
+
+// Path is the file's name after the change, or before it for deletions
+func (f FileDiff) Path() string {
+	if f.NewPath == "" {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+// ModeChanged reports whether the file's permissions or type changed
+func (f FileDiff) ModeChanged() bool {
+	return f.Status == FileModified && f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode
+}
+
+// Patch renders the file header and the selected hunks as a patch that `git
+// apply` accepts. Once a hunk has been skipped, the new-side line numbers
+// of the ones after it are recomputed so that the patch stays consistent.
+func (f FileDiff) Patch(selected []int) string {
+	var b strings.Builder
+	for _, line := range f.Header {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	delta := 0
+	skipped := false
+	for i, hunk := range f.Hunks {
+		if !intInSlice(i, selected) {
+			skipped = true
+			continue
+		}
+		newStart := hunk.NewStart
+		if skipped {
+			newStart = hunk.newStartAfter(delta)
+		}
+		b.WriteString(hunk.renderHeader(newStart))
+		b.WriteString("\n")
+		for _, line := range hunk.Lines {
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		delta += hunk.NewLines - hunk.OldLines
+	}
+	return b.String()
+}
+
+// AllHunks returns the indexes of every hunk, for use with Patch
+func (f FileDiff) AllHunks() []int {
+	indexes := make([]int, len(f.Hunks))
+	for i := range f.Hunks {
+		indexes[i] = i
+	}
+	return indexes
+}
+
+// DiffToJSON serialises parsed files for storage and for the Python side
+func DiffToJSON(files []FileDiff) (string, error) {
+	if files == nil {
+		files = []FileDiff{}
+	}
+	out, err := json.Marshal(files)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// newStartAfter is where the hunk starts on the new side when the kept
+// hunks before it changed the line count by delta. An empty range names the
+// line before it, so pure inserts start one line after their old start and
+// pure deletions one line before.
+func (h Hunk) newStartAfter(delta int) int {
+	switch {
+	case h.OldLines == 0 && h.NewLines > 0:
+		return h.OldStart + 1 + delta
+	case h.NewLines == 0 && h.OldLines > 0:
+		return h.OldStart - 1 + delta
+	}
+	return h.OldStart + delta
+}
+
+func (h Hunk) renderHeader(newStart int) string {
+	// A hunk that only adds lines to an empty file starts at 0
+	if h.NewLines > 0 && newStart < 1 {
+		newStart = 1
+	}
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, newStart, h.NewLines)
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+	return header
+}
+
+func (h Hunk) String() string {
+	return h.renderHeader(h.NewStart) + "\n" + strings.Join(h.Lines, "\n")
+}
+
+// parseDiffGitPaths reads the two paths of a "diff --git" line. Unquoted
+// paths may contain spaces, which makes the line ambiguous; both halves are
+// then assumed to name the same file, and renames get corrected later by
+// their "rename from/to" lines.
+func parseDiffGitPaths(paths string) (string, string) {
+	if strings.HasPrefix(paths, `"`) {
+		oldPath, rest, ok := cutQuoted(paths)
+		if ok {
+			return strings.TrimPrefix(oldPath, "a/"), parseDiffPath(strings.TrimSpace(rest), "b/")
+		}
+	}
+	if i := strings.Index(paths, ` "b/`); i >= 0 {
+		return strings.TrimPrefix(paths[:i], "a/"), parseDiffPath(paths[i+1:], "b/")
+	}
+	if len(paths)%2 == 1 {
+		half := len(paths) / 2
+		oldPath, newPath := paths[:half], paths[half+1:]
+		if strings.HasPrefix(oldPath, "a/") && strings.HasPrefix(newPath, "b/") && oldPath[2:] == newPath[2:] {
+			return oldPath[2:], newPath[2:]
+		}
+	}
+	if i := strings.Index(paths, " b/"); i >= 0 {
+		return strings.TrimPrefix(paths[:i], "a/"), paths[i+3:]
+	}
+	return paths, paths
+}
+
+// parseDiffPath reads the path from a ---/+++ line
+func parseDiffPath(path string, prefix string) string {
+	// git appends a tab to names containing spaces
+	path = strings.TrimSuffix(path, "\t")
+	if path == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(unquoteDiffPath(path), prefix)
+}
+
+// unquoteDiffPath undoes git's C-style quoting of unusual file names
+func unquoteDiffPath(path string) string {
+	if unquoted, _, ok := cutQuoted(path); ok {
+		return unquoted
+	}
+	return path
+}
+
+// cutQuoted unquotes the C-style quoted string at the start of s and returns
+// it with the rest of s
+func cutQuoted(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			unquoted, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", s, false
+			}
+			return unquoted, s[i+1:], true
+		}
+	}
+	return "", s, false
+}
+
+func atoiOr(s string, fallback int) int {
+	if s == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
 // func main() {
 // 	// Example usage
 // 	diff := `diff --git a/file1.txt b/file1.txt
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Gitmoji is one entry of the gitmoji set. Section is the changelog section
+// commits with this gitmoji go to, or Skip.
+type Gitmoji struct {
+	Emoji       string `json:"emoji"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	Section     string `json:"section"`
+}
+
+// canonicalGitmojis is the set from gitmoji.dev
+var canonicalGitmojis = []Gitmoji{
+	{"🎨", ":art:", "Improve structure / format of the code", changelogSkip},
+	{"⚡️", ":zap:", "Improve performance", "Changed"},
+	{"🔥", ":fire:", "Remove code or files", "Removed"},
+	{"🐛", ":bug:", "Fix a bug", "Fixed"},
+	{"🚑️", ":ambulance:", "Critical hotfix", "Fixed"},
+	{"✨", ":sparkles:", "Introduce new features", "Added"},
+	{"📝", ":memo:", "Add or update documentation", changelogSkip},
+	{"🚀", ":rocket:", "Deploy stuff", changelogSkip},
+	{"💄", ":lipstick:", "Add or update the UI and style files", "Changed"},
+	{"🎉", ":tada:", "Begin a project", changelogSkip},
+	{"✅", ":white_check_mark:", "Add, update, or pass tests", changelogSkip},
+	{"🔒️", ":lock:", "Fix security or privacy issues", "Security"},
+	{"🔐", ":closed_lock_with_key:", "Add or update secrets", changelogSkip},
+	{"🔖", ":bookmark:", "Release / Version tags", changelogSkip},
+	{"🚨", ":rotating_light:", "Fix compiler / linter warnings", changelogSkip},
+	{"🚧", ":construction:", "Work in progress", changelogSkip},
+	{"💚", ":green_heart:", "Fix CI Build", changelogSkip},
+	{"⬇️", ":arrow_down:", "Downgrade dependencies", "Changed"},
+	{"⬆️", ":arrow_up:", "Upgrade dependencies", "Changed"},
+	{"📌", ":pushpin:", "Pin dependencies to specific versions", "Changed"},
+	{"👷", ":construction_worker:", "Add or update CI build system", changelogSkip},
+	{"📈", ":chart_with_upwards_trend:", "Add or update analytics or track code", "Changed"},
+	{"♻️", ":recycle:", "Refactor code", changelogSkip},
+	{"➕", ":heavy_plus_sign:", "Add a dependency", "Changed"},
+	{"➖", ":heavy_minus_sign:", "Remove a dependency", "Changed"},
+	{"🔧", ":wrench:", "Add or update configuration files", changelogSkip},
+	{"🔨", ":hammer:", "Add or update development scripts", changelogSkip},
+	{"🌐", ":globe_with_meridians:", "Internationalization and localization", "Changed"},
+	{"✏️", ":pencil2:", "Fix typos", "Fixed"},
+	{"💩", ":poop:", "Write bad code that needs to be improved", changelogSkip},
+	{"⏪️", ":rewind:", "Revert changes", "Changed"},
+	{"🔀", ":twisted_rightwards_arrows:", "Merge branches", changelogSkip},
+	{"📦️", ":package:", "Add or update compiled files or packages", changelogSkip},
+	{"👽️", ":alien:", "Update code due to external API changes", "Changed"},
+	{"🚚", ":truck:", "Move or rename resources (e.g.: files, paths, routes)", "Changed"},
+	{"📄", ":page_facing_up:", "Add or update license", changelogSkip},
+	{"💥", ":boom:", "Introduce breaking changes", "Changed"},
+	{"🍱", ":bento:", "Add or update assets", "Changed"},
+	{"♿️", ":wheelchair:", "Improve accessibility", "Changed"},
+	{"💡", ":bulb:", "Add or update comments in source code", changelogSkip},
+	{"🍻", ":beers:", "Write code drunkenly", changelogSkip},
+	{"💬", ":speech_balloon:", "Add or update text and literals", "Changed"},
+	{"🗃️", ":card_file_box:", "Perform database related changes", "Changed"},
+	{"🔊", ":loud_sound:", "Add or update logs", "Changed"},
+	{"🔇", ":mute:", "Remove logs", "Changed"},
+	{"👥", ":busts_in_silhouette:", "Add or update contributor(s)", changelogSkip},
+	{"🚸", ":children_crossing:", "Improve user experience / usability", "Changed"},
+	{"🏗️", ":building_construction:", "Make architectural changes", changelogSkip},
+	{"📱", ":iphone:", "Work on responsive design", "Changed"},
+	{"🤡", ":clown_face:", "Mock things", changelogSkip},
+	{"🥚", ":egg:", "Add or update an easter egg", "Added"},
+	{"🙈", ":see_no_evil:", "Add or update a .gitignore file", changelogSkip},
+	{"📸", ":camera_flash:", "Add or update snapshots", changelogSkip},
+	{"⚗️", ":alembic:", "Perform experiments", changelogSkip},
+	{"🔍️", ":mag:", "Improve SEO", "Changed"},
+	{"🏷️", ":label:", "Add or update types", changelogSkip},
+	{"🌱", ":seedling:", "Add or update seed files", changelogSkip},
+	{"🚩", ":triangular_flag_on_post:", "Add, update, or remove feature flags", "Changed"},
+	{"🥅", ":goal_net:", "Catch errors", "Fixed"},
+	{"💫", ":dizzy:", "Add or update animations and transitions", "Changed"},
+	{"🗑️", ":wastebasket:", "Deprecate code that needs to be cleaned up", "Deprecated"},
+	{"🛂", ":passport_control:", "Work on code related to authorization, roles and permissions", "Changed"},
+	{"🩹", ":adhesive_bandage:", "Simple fix for a non-critical issue", "Fixed"},
+	{"🧐", ":monocle_face:", "Data exploration/inspection", changelogSkip},
+	{"⚰️", ":coffin:", "Remove dead code", changelogSkip},
+	{"🧪", ":test_tube:", "Add a failing test", changelogSkip},
+	{"👔", ":necktie:", "Add or update business logic", "Changed"},
+	{"🩺", ":stethoscope:", "Add or update healthcheck", "Changed"},
+	{"🧱", ":bricks:", "Infrastructure related changes", changelogSkip},
+	{"🧑‍💻", ":technologist:", "Improve developer experience", changelogSkip},
+	{"💸", ":money_with_wings:", "Add sponsorships or money related infrastructure", changelogSkip},
+	{"🧵", ":thread:", "Add or update code related to multithreading or concurrency", "Changed"},
+	{"🦺", ":safety_vest:", "Add or update code related to validation", "Changed"},
+	{"✈️", ":airplane:", "Improve offline support", "Changed"},
+}
+
+// gitmojiBreakingCode marks breaking changes, like a ! in Conventional Commits
+const gitmojiBreakingCode = ":boom:"
+
+var gitmojiCodeRegex = regexp.MustCompile(`^:[a-z0-9_+-]+:$`)
+
+// stripVariation drops emoji variation selectors, which are optional and
+// often lost when messages are typed or copied
+func stripVariation(s string) string {
+	return strings.ReplaceAll(s, "\uFE0F", "")
+}
+
+// parseGitmojiSubject finds the gitmoji a subject starts with, as emoji or
+// shortcode, and returns the rest of the subject
+func parseGitmojiSubject(subject string, gitmojis []Gitmoji) (Gitmoji, string, bool) {
+	subject = strings.TrimSpace(subject)
+	bare := stripVariation(subject)
+	for _, gitmoji := range gitmojis {
+		if rest, ok := strings.CutPrefix(subject, gitmoji.Code); ok {
+			return gitmoji, strings.TrimSpace(rest), true
+		}
+		if rest, ok := strings.CutPrefix(bare, stripVariation(gitmoji.Emoji)); ok {
+			return gitmoji, strings.TrimSpace(rest), true
+		}
+	}
+	return Gitmoji{}, "", false
+}
+
+// formatGitmoji writes a gitmoji the way the config asks for
+func formatGitmoji(gitmoji Gitmoji, format string) string {
+	if format == "shortcode" {
+		return gitmoji.Code
+	}
+	return gitmoji.Emoji
+}
+
+// normalizeGitmoji rewrites the subject's gitmoji in the configured format,
+// since models mix up emoji and shortcodes
+func normalizeGitmoji(message string, config LintConfig) string {
+	if config.Style != "gitmoji" {
+		return message
+	}
+	subject, rest, hasRest := strings.Cut(message, "\n")
+	gitmoji, description, ok := parseGitmojiSubject(subject, config.Gitmojis)
+	if !ok {
+		return message
+	}
+	subject = formatGitmoji(gitmoji, config.GitmojiFormat) + " " + description
+	if !hasRest {
+		return subject
+	}
+	return subject + "\n" + rest
+}
+
+// describeGitmojis lists the set for the prompt
+func describeGitmojis(config LintConfig) string {
+	var lines []string
+	for _, gitmoji := range config.Gitmojis {
+		lines = append(lines, fmt.Sprintf("  %s %s", formatGitmoji(gitmoji, config.GitmojiFormat), gitmoji.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateGitmojis checks a configured set. Entries that only name a
+// canonical code are completed from the canonical set.
+func validateGitmojis(gitmojis []Gitmoji) ([]Gitmoji, error) {
+	canonical := map[string]Gitmoji{}
+	for _, gitmoji := range canonicalGitmojis {
+		canonical[gitmoji.Code] = gitmoji
+	}
+	seen := map[string]bool{}
+	validated := make([]Gitmoji, 0, len(gitmojis))
+	for _, gitmoji := range gitmojis {
+		if !gitmojiCodeRegex.MatchString(gitmoji.Code) {
+			return nil, fmt.Errorf("gitmoji code %q must look like :name:", gitmoji.Code)
+		}
+		if known, ok := canonical[gitmoji.Code]; ok {
+			if gitmoji.Emoji == "" {
+				gitmoji.Emoji = known.Emoji
+			}
+			if gitmoji.Description == "" {
+				gitmoji.Description = known.Description
+			}
+			if gitmoji.Section == "" {
+				gitmoji.Section = known.Section
+			}
+		}
+		if gitmoji.Emoji == "" || gitmoji.Description == "" {
+			return nil, fmt.Errorf("gitmoji %s is not canonical and needs an emoji and a description", gitmoji.Code)
+		}
+		if gitmoji.Section == "" {
+			gitmoji.Section = "Changed"
+		}
+		if !StringInSlice(gitmoji.Section, changelogSections) && gitmoji.Section != changelogSkip {
+			return nil, fmt.Errorf("gitmoji %s has section %q, expected one of %s or %s", gitmoji.Code, gitmoji.Section, strings.Join(changelogSections, ", "), changelogSkip)
+		}
+		for _, key := range []string{gitmoji.Code, stripVariation(gitmoji.Emoji)} {
+			if seen[key] {
+				return nil, fmt.Errorf("gitmoji %s is in the set twice", key)
+			}
+			seen[key] = true
+		}
+		validated = append(validated, gitmoji)
+	}
+	return validated, nil
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/phuslu/log"
+)
+
+const goAPIPrompt = "\nThe Go API changes below were found by parsing the code before and after the change. Name the API that changed where it matters, with these exact names.\n"
+
+const goBreakingPrompt = "Changes marked breaking break code that uses the package, say so in the body.\n"
+
+const goBreakingFooterPrompt = "The BREAKING-CHANGE footer is added separately.\n"
+
+// maxGoAPIChanges keeps the summary of a large refactoring from taking over
+// the prompt
+const maxGoAPIChanges = 40
+
+// goSymbol is an exported declaration. Members are named Type.Member.
+type goSymbol struct {
+	Kind      string // func, method, type, field, interface method, const or var
+	Name      string
+	Signature string // the declared type, without parameter names
+}
+
+func (s goSymbol) String() string {
+	switch {
+	case s.Signature == "":
+		return s.Kind + " " + s.Name
+	case strings.HasPrefix(s.Signature, "(") || strings.HasPrefix(s.Signature, "["):
+		// Functions and generic types read like their declaration
+		return s.Kind + " " + s.Name + s.Signature
+	}
+	return s.Kind + " " + s.Name + " " + s.Signature
+}
+
+// goAPIChange is a symbol that was added, removed or changed in a package
+type goAPIChange struct {
+	Package  string // the package's directory
+	Change   string // added, removed or changed
+	Before   goSymbol
+	After    goSymbol
+	Breaking bool
+}
+
+func (c goAPIChange) String() string {
+	var line string
+	switch c.Change {
+	case "added":
+		line = "+ " + c.After.String()
+	case "removed":
+		line = "- " + c.Before.String()
+	default:
+		line = "~ " + c.Before.String() + " -> " + c.After.String()
+	}
+	if c.Breaking {
+		line += " (breaking)"
+	}
+	return line
+}
+
+// goAPISummary is what a change does to the Go API of the packages it
+// touches
+type goAPISummary struct {
+	NewPackages     []string
+	RemovedPackages []string
+	Changes         []goAPIChange
+	breakingRemoved []string // removed packages that could be imported
+}
+
+// goFileVersions is a changed Go file before and after the change
+type goFileVersions struct {
+	file   FileDiff
+	before string
+	after  string
+}
+
+// applyHunks rebuilds the new version of a file from the old one. This
+// works for any diff, including partial selections, where the new version
+// isn't in git or on disk. It fails when the context doesn't match.
+func applyHunks(old string, hunks []Hunk) (string, bool) {
+	oldLines := strings.SplitAfter(old, "\n")
+	if old == "" {
+		oldLines = nil
+	}
+	var b strings.Builder
+	next := 0
+	for _, hunk := range hunks {
+		// A hunk that only adds lines starts after its old start line
+		start := hunk.OldStart - 1
+		if hunk.OldLines == 0 {
+			start = hunk.OldStart
+		}
+		if start < next || start > len(oldLines) {
+			return "", false
+		}
+		for ; next < start; next++ {
+			b.WriteString(oldLines[next])
+		}
+		for _, line := range hunk.Lines {
+			if line == "" {
+				line = " "
+			}
+			switch line[0] {
+			case ' ', '-':
+				if next >= len(oldLines) || strings.TrimSuffix(oldLines[next], "\n") != line[1:] {
+					return "", false
+				}
+				if line[0] == ' ' {
+					b.WriteString(oldLines[next])
+				}
+				next++
+			case '+':
+				b.WriteString(line[1:] + "\n")
+			}
+		}
+	}
+	for ; next < len(oldLines); next++ {
+		b.WriteString(oldLines[next])
+	}
+	return b.String(), true
+}
+
+// goFileChanges reads both versions of the changed Go files. The old one
+// comes from the blob named in the diff. Tests and generated code are not
+// API and are left out.
+func goFileChanges(files []FileDiff) []goFileVersions {
+	var changes []goFileVersions
+	for _, file := range files {
+		if !strings.HasSuffix(file.Path(), ".go") || strings.HasSuffix(file.Path(), "_test.go") || ClassifyFile(file) != KindSource {
+			continue
+		}
+		var before string
+		if file.Status != FileAdded {
+			if file.OldHash == "" {
+				continue
+			}
+			var err error
+			if before, err = runGitRaw("", "cat-file", "blob", file.OldHash); err != nil {
+				log.Debug().Err(err).Str("file", file.Path()).Msg("could not read the old version")
+				continue
+			}
+		}
+		after := ""
+		if file.Status != FileDeleted {
+			var ok bool
+			if after, ok = applyHunks(before, file.Hunks); !ok {
+				log.Debug().Str("file", file.Path()).Msg("the diff doesn't apply to the old version")
+				continue
+			}
+		}
+		changes = append(changes, goFileVersions{file: file, before: before, after: after})
+	}
+	return changes
+}
+
+// goPackageAPI is the exported API found in some files of a package
+type goPackageAPI struct {
+	Name    string
+	Symbols map[string]goSymbol
+}
+
+func fieldTypes(fields *ast.FieldList) []string {
+	if fields == nil {
+		return nil
+	}
+	var list []string
+	for _, field := range fields.List {
+		for i := 0; i < max(1, len(field.Names)); i++ {
+			list = append(list, types.ExprString(field.Type))
+		}
+	}
+	return list
+}
+
+func typeParams(params *ast.FieldList) string {
+	if params == nil {
+		return ""
+	}
+	var list []string
+	for _, field := range params.List {
+		for _, name := range field.Names {
+			list = append(list, name.Name+" "+types.ExprString(field.Type))
+		}
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// funcSignature leaves out parameter names, since renaming them doesn't
+// change the API
+func funcSignature(typeParamList *ast.FieldList, funcType *ast.FuncType) string {
+	signature := typeParams(typeParamList) + "(" + strings.Join(fieldTypes(funcType.Params), ", ") + ")"
+	results := fieldTypes(funcType.Results)
+	switch len(results) {
+	case 0:
+	case 1:
+		signature += " " + results[0]
+	default:
+		signature += " (" + strings.Join(results, ", ") + ")"
+	}
+	return signature
+}
+
+// embeddedName is the name of an embedded field's type
+func embeddedName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.IndexExpr:
+		return embeddedName(e.X)
+	case *ast.IndexListExpr:
+		return embeddedName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// addTypeSymbols adds a type and its exported fields or interface methods
+func (api *goPackageAPI) addTypeSymbols(spec *ast.TypeSpec) {
+	name := spec.Name.Name
+	symbol := goSymbol{Kind: "type", Name: name}
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		symbol.Signature = strings.TrimSpace(typeParams(spec.TypeParams) + " struct")
+		for _, field := range t.Fields.List {
+			names := field.Names
+			if len(names) == 0 {
+				names = []*ast.Ident{ast.NewIdent(embeddedName(field.Type))}
+			}
+			for _, fieldName := range names {
+				if fieldName.IsExported() {
+					api.Symbols[name+"."+fieldName.Name] = goSymbol{Kind: "field", Name: name + "." + fieldName.Name, Signature: types.ExprString(field.Type)}
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		symbol.Signature = strings.TrimSpace(typeParams(spec.TypeParams) + " interface")
+		for _, method := range t.Methods.List {
+			funcType, ok := method.Type.(*ast.FuncType)
+			if !ok || len(method.Names) == 0 || !method.Names[0].IsExported() {
+				continue
+			}
+			methodName := name + "." + method.Names[0].Name
+			api.Symbols[methodName] = goSymbol{Kind: "interface method", Name: methodName, Signature: funcSignature(nil, funcType)}
+		}
+	default:
+		symbol.Signature = strings.TrimSpace(typeParams(spec.TypeParams) + " " + types.ExprString(spec.Type))
+		if spec.Assign.IsValid() {
+			symbol.Signature = "= " + symbol.Signature
+		}
+	}
+	api.Symbols[name] = symbol
+}
+
+// addFile adds the exported declarations of a file. It reports whether the
+// file parsed.
+func (api *goPackageAPI) addFile(filePath string, src string) bool {
+	parsed, err := parser.ParseFile(token.NewFileSet(), filePath, src, parser.SkipObjectResolution)
+	if err != nil {
+		return false
+	}
+	api.Name = parsed.Name.Name
+	for _, decl := range parsed.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			if decl.Recv == nil {
+				api.Symbols[decl.Name.Name] = goSymbol{Kind: "func", Name: decl.Name.Name, Signature: funcSignature(decl.Type.TypeParams, decl.Type)}
+			} else if receiver := receiverName(decl.Recv); ast.IsExported(receiver) {
+				name := receiver + "." + decl.Name.Name
+				api.Symbols[name] = goSymbol{Kind: "method", Name: name, Signature: funcSignature(nil, decl.Type)}
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						api.addTypeSymbols(spec)
+					}
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					signature := ""
+					if spec.Type != nil {
+						signature = types.ExprString(spec.Type)
+					}
+					for _, name := range spec.Names {
+						if name.IsExported() {
+							api.Symbols[name.Name] = goSymbol{Kind: kind, Name: name.Name, Signature: signature}
+						}
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+func receiverName(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// goPackageAPIAt parses the Go files of a directory at a revision. Files
+// that don't parse are skipped.
+func goPackageAPIAt(ref string, dir string) goPackageAPI {
+	api := goPackageAPI{Symbols: map[string]goSymbol{}}
+	for _, file := range goFilesAt(ref, dir) {
+		src, err := runGitRaw("", "show", ref+":"+file)
+		if err != nil {
+			continue
+		}
+		api.addFile(file, src)
+	}
+	return api
+}
+
+// goFilesAt lists the non-test Go files of a directory at a revision
+func goFilesAt(ref string, dir string) []string {
+	args := []string{"ls-tree", "--name-only", "--full-tree", ref}
+	if dir != "." {
+		args = append(args, dir+"/")
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, file := range strings.Split(out, "\n") {
+		if strings.HasSuffix(file, ".go") && !strings.HasSuffix(file, "_test.go") {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func isNonAPIDir(dir string) bool {
+	for _, element := range strings.Split(dir, "/") {
+		if element == "internal" || element == "testdata" || element == "vendor" || (strings.HasPrefix(element, ".") && element != ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isImportable tells whether other modules can use a package, which is
+// when API changes can break someone
+func isImportable(dir string, name string) bool {
+	return name != "main" && !isNonAPIDir(dir)
+}
+
+// hasOtherGoFiles tells whether a directory has non-test Go files besides
+// the given ones, at HEAD or, without a ref, in the working tree
+func hasOtherGoFiles(dir string, ref string, known map[string]bool) bool {
+	var names []string
+	if ref != "" {
+		names = goFilesAt(ref, dir)
+	} else if entries, err := os.ReadDir(worktreePath(dir)); err == nil {
+		for _, entry := range entries {
+			names = append(names, path.Join(dir, entry.Name()))
+		}
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") && !known[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeGoAPI compares the exported API of the changed Go files before
+// and after the change, package by package. Only the changed files are
+// parsed, which is enough since a symbol can't appear or vanish in a file
+// the change doesn't touch.
+func summarizeGoAPI(files []FileDiff) goAPISummary {
+	before := map[string]*goPackageAPI{}
+	after := map[string]*goPackageAPI{}
+	added := map[string][]string{}
+	deleted := map[string][]string{}
+	touched := map[string]int{}
+	packageAPI := func(apis map[string]*goPackageAPI, dir string) *goPackageAPI {
+		if apis[dir] == nil {
+			apis[dir] = &goPackageAPI{Symbols: map[string]goSymbol{}}
+		}
+		return apis[dir]
+	}
+
+	for _, change := range goFileChanges(files) {
+		file := change.file
+		// Both versions have to parse, or a syntax error would look like
+		// everything in the file was removed
+		oldAPI := goPackageAPI{Symbols: map[string]goSymbol{}}
+		newAPI := goPackageAPI{Symbols: map[string]goSymbol{}}
+		if file.Status != FileAdded && !oldAPI.addFile(file.OldPath, change.before) {
+			continue
+		}
+		if file.Status != FileDeleted && !newAPI.addFile(file.NewPath, change.after) {
+			continue
+		}
+		if file.Status != FileAdded {
+			dir := path.Dir(file.OldPath)
+			api := packageAPI(before, dir)
+			api.Name = oldAPI.Name
+			for name, symbol := range oldAPI.Symbols {
+				api.Symbols[name] = symbol
+			}
+			touched[dir]++
+		}
+		if file.Status != FileDeleted {
+			dir := path.Dir(file.NewPath)
+			api := packageAPI(after, dir)
+			api.Name = newAPI.Name
+			for name, symbol := range newAPI.Symbols {
+				api.Symbols[name] = symbol
+			}
+			if file.Status != FileRenamed || path.Dir(file.OldPath) != dir {
+				touched[dir]++
+			}
+		}
+		switch file.Status {
+		case FileAdded:
+			added[path.Dir(file.NewPath)] = append(added[path.Dir(file.NewPath)], file.NewPath)
+		case FileDeleted:
+			deleted[path.Dir(file.OldPath)] = append(deleted[path.Dir(file.OldPath)], file.OldPath)
+		}
+	}
+
+	var summary goAPISummary
+	dirs := make([]string, 0, len(touched))
+	for dir := range touched {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		oldAPI, newAPI := packageAPI(before, dir), packageAPI(after, dir)
+		name := newAPI.Name
+		if name == "" {
+			name = oldAPI.Name
+		}
+		importable := isImportable(dir, name)
+
+		known := map[string]bool{}
+		for _, file := range append(added[dir], deleted[dir]...) {
+			known[file] = true
+		}
+		isNew := len(added[dir]) == touched[dir] && !hasOtherGoFiles(dir, "HEAD", known)
+		isRemoved := len(deleted[dir]) == touched[dir] && !hasOtherGoFiles(dir, "", known)
+		switch {
+		case isNew:
+			summary.NewPackages = append(summary.NewPackages, dir)
+			continue
+		case isRemoved:
+			summary.RemovedPackages = append(summary.RemovedPackages, dir)
+			if importable {
+				summary.breakingRemoved = append(summary.breakingRemoved, dir)
+			}
+			continue
+		}
+		summary.Changes = append(summary.Changes, compareGoAPI(dir, oldAPI.Symbols, newAPI.Symbols, importable)...)
+	}
+	return summary
+}
+
+// compareGoAPI lists what changed between two versions of a package's API.
+// Removing or changing anything breaks users, and so does adding a method
+// to an interface they may implement.
+func compareGoAPI(dir string, before map[string]goSymbol, after map[string]goSymbol, importable bool) []goAPIChange {
+	var names []string
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []goAPIChange
+	for _, name := range names {
+		oldSymbol, existed := before[name]
+		newSymbol, exists := after[name]
+		change := goAPIChange{Package: dir, Before: oldSymbol, After: newSymbol}
+		switch {
+		case !exists:
+			change.Change = "removed"
+			change.Breaking = importable
+		case !existed:
+			change.Change = "added"
+			if newSymbol.Kind == "interface method" {
+				owner, _, _ := strings.Cut(name, ".")
+				_, ownerExisted := before[owner]
+				change.Breaking = importable && ownerExisted
+			}
+		case oldSymbol.Kind != newSymbol.Kind || oldSymbol.Signature != newSymbol.Signature:
+			change.Change = "changed"
+			change.Breaking = importable
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Breaking describes the breaking changes, for the footer
+func (s goAPISummary) Breaking() []string {
+	var breaking []string
+	for _, dir := range s.breakingRemoved {
+		breaking = append(breaking, "removes package "+dir)
+	}
+	for _, change := range s.Changes {
+		if !change.Breaking {
+			continue
+		}
+		symbol := change.After
+		if change.Change == "removed" {
+			symbol = change.Before
+		}
+		verb := map[string]string{"added": "adds", "removed": "removes", "changed": "changes"}[change.Change]
+		breaking = append(breaking, fmt.Sprintf("%s %s %s", verb, symbol.Kind, qualifiedName(change.Package, symbol.Name)))
+	}
+	return breaking
+}
+
+func qualifiedName(dir string, name string) string {
+	if dir == "." {
+		return name
+	}
+	return dir + "." + name
+}
+
+func (s goAPISummary) Empty() bool {
+	return len(s.NewPackages) == 0 && len(s.RemovedPackages) == 0 && len(s.Changes) == 0
+}
+
+func (s goAPISummary) String() string {
+	var b strings.Builder
+	for _, dir := range s.NewPackages {
+		fmt.Fprintf(&b, "new package %s\n", dir)
+	}
+	for _, dir := range s.RemovedPackages {
+		fmt.Fprintf(&b, "removed package %s\n", dir)
+	}
+	dir := ""
+	for i, change := range s.Changes {
+		if i == maxGoAPIChanges {
+			fmt.Fprintf(&b, "and %d more\n", len(s.Changes)-i)
+			break
+		}
+		if change.Package != dir || i == 0 {
+			dir = change.Package
+			fmt.Fprintf(&b, "package %s:\n", dir)
+		}
+		b.WriteString("  " + change.String() + "\n")
+	}
+	return b.String()
+}
+
+// prompt is the summary as part of the system prompt
+func (s goAPISummary) prompt(config LintConfig) string {
+	if s.Empty() {
+		return ""
+	}
+	prompt := goAPIPrompt
+	if len(s.Breaking()) > 0 {
+		prompt += goBreakingPrompt
+		if config.Conventional {
+			prompt += goBreakingFooterPrompt
+		}
+	}
+	return prompt + s.String()
+}
+
+// markBreaking adds a BREAKING-CHANGE footer listing the breaking changes,
+// unless the message already has a breaking change footer. The footer is a
+// Conventional Commits one, so other styles don't get it.
+func (s goAPISummary) markBreaking(message string, config LintConfig) string {
+	breaking := s.Breaking()
+	if !config.Conventional || len(breaking) == 0 || breakingFooterRegex.MatchString(message) {
+		return message
+	}
+	if len(breaking) > 5 {
+		breaking = append(breaking[:5], fmt.Sprintf("and %d more", len(breaking)-5))
+	}
+	return addTrailer(message, "BREAKING-CHANGE", strings.Join(breaking, ", "))
+}
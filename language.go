@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/phuslu/log"
+)
+
+// language is a language messages can be written in. Languages with a
+// script or stopwords can be detected; others are only named in the prompt.
+type language struct {
+	Code      string
+	Name      string
+	script    *unicode.RangeTable
+	stopwords []string
+}
+
+var languages = []language{
+	{Code: "en", Name: "English", stopwords: []string{"the", "and", "to", "of", "for", "in", "with", "from", "on", "when", "is", "it", "this", "that", "be", "by", "instead", "now", "so", "not"}},
+	{Code: "de", Name: "German", stopwords: []string{"der", "die", "das", "und", "ist", "nicht", "mit", "für", "von", "zu", "im", "beim", "den", "dem", "ein", "eine", "wird", "werden", "auf", "aus", "bei", "nach", "über", "statt", "jetzt", "füge", "behebe", "entferne", "aktualisiere", "hinzufügen", "entfernen", "beheben"}},
+	{Code: "fr", Name: "French", stopwords: []string{"le", "la", "les", "et", "des", "du", "pour", "dans", "avec", "est", "une", "un", "sur", "pas", "au", "aux", "par", "lors", "ajoute", "corrige", "supprime", "ajouter", "corriger", "supprimer"}},
+	{Code: "es", Name: "Spanish", stopwords: []string{"el", "la", "los", "las", "y", "de", "del", "para", "en", "con", "es", "una", "un", "por", "al", "cuando", "agrega", "añade", "corrige", "elimina", "agregar", "corregir", "eliminar"}},
+	{Code: "pt", Name: "Portuguese", stopwords: []string{"o", "a", "os", "as", "e", "do", "da", "dos", "das", "para", "em", "com", "é", "um", "uma", "por", "ao", "quando", "não", "adiciona", "corrige", "remove", "adicionar", "corrigir"}},
+	{Code: "it", Name: "Italian", stopwords: []string{"il", "lo", "la", "gli", "le", "e", "di", "del", "della", "per", "in", "con", "è", "un", "una", "da", "non", "quando", "aggiunge", "corregge", "rimuove", "aggiungi", "correggi"}},
+	{Code: "nl", Name: "Dutch", stopwords: []string{"de", "het", "een", "en", "van", "voor", "in", "met", "is", "niet", "op", "bij", "naar", "wordt", "toevoegen", "verwijderen", "repareer", "voeg"}},
+	{Code: "ja", Name: "Japanese", script: unicode.Hiragana},
+	{Code: "ko", Name: "Korean", script: unicode.Hangul},
+	{Code: "zh", Name: "Chinese", script: unicode.Han},
+	{Code: "ru", Name: "Russian", script: unicode.Cyrillic},
+}
+
+// minLanguageWords is how much text detection needs to be worth trusting
+const minLanguageWords = 3
+
+// lookupLanguage finds a language by code or English name. Unknown names
+// are kept as they are, so they can still be asked for.
+func lookupLanguage(name string) language {
+	for _, lang := range languages {
+		if strings.EqualFold(name, lang.Code) || strings.EqualFold(name, lang.Name) {
+			return lang
+		}
+	}
+	return language{Name: name}
+}
+
+// detectLanguage guesses the language of a text. Scripts decide for
+// languages that have their own, otherwise stopwords are counted. It only
+// answers when one language clearly wins.
+func detectLanguage(text string) (language, bool) {
+	// Code and trailers say nothing about the language
+	text, _ = splitTrailers(text)
+	var prose []string
+	for i, part := range strings.Split(text, "`") {
+		if i%2 == 0 {
+			prose = append(prose, part)
+		}
+	}
+	text = strings.Join(prose, " ")
+
+	var letters, kana int
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hiragana, r) {
+			kana++
+		}
+		for _, lang := range languages {
+			if lang.script != nil && unicode.Is(lang.script, r) {
+				scripts[lang.Code]++
+			}
+		}
+	}
+	if letters == 0 {
+		return language{}, false
+	}
+	// Kanji is shared with Chinese, kana is what makes text Japanese
+	if kana > 0 && kana+scripts["zh"] >= letters/5 {
+		return lookupLanguage("ja"), true
+	}
+	for _, code := range []string{"ko", "zh", "ru"} {
+		if scripts[code] >= letters/5 {
+			return lookupLanguage(code), true
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < minLanguageWords {
+		return language{}, false
+	}
+	type score struct {
+		lang language
+		hits int
+	}
+	var scores []score
+	for _, lang := range languages {
+		hits := 0
+		for _, word := range words {
+			if StringInSlice(word, lang.stopwords) {
+				hits++
+			}
+		}
+		scores = append(scores, score{lang, hits})
+	}
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].hits > scores[j].hits })
+	if scores[0].hits < 2 || scores[0].hits < 2*scores[1].hits {
+		return language{}, false
+	}
+	return scores[0].lang, true
+}
+
+// detectRepoLanguage is the language most recent commits are written in,
+// if they agree well enough
+func detectRepoLanguage() (language, bool) {
+	commits, err := logCommits("HEAD", "--max-count=30", "--no-merges")
+	if err != nil {
+		return language{}, false
+	}
+	votes := map[string]int{}
+	total := 0
+	for _, commit := range commits {
+		if lang, ok := detectLanguage(commit.Subject + "\n\n" + commit.Body); ok {
+			votes[lang.Code]++
+			total++
+		}
+	}
+	best := ""
+	for code, count := range votes {
+		if best == "" || count > votes[best] || (count == votes[best] && code < best) {
+			best = code
+		}
+	}
+	if best == "" || votes[best] < 3 || votes[best]*2 <= total {
+		return language{}, false
+	}
+	return lookupLanguage(best), true
+}
+
+// messageLanguage works out the language messages are written in: the
+// --language flag, then the repository config, then the profile. "auto"
+// follows the repository's history. No language leaves it to the model.
+func messageLanguage(repoConfig RepoConfig, profile string, override string) language {
+	setting := profile
+	if repoConfig.Language != "" {
+		setting = repoConfig.Language
+	}
+	if override != "" {
+		setting = override
+	}
+	setting = strings.TrimSpace(setting)
+	if strings.EqualFold(setting, "auto") {
+		lang, _ := detectRepoLanguage()
+		return lang
+	}
+	if setting == "" {
+		return language{}
+	}
+	return lookupLanguage(setting)
+}
+
+func languagePrompt(lang language) string {
+	if lang.Name == "" {
+		return ""
+	}
+	return "Write the commit message in " + lang.Name + ". Keep code identifiers, file names, commit types and trailer keys as they are.\n"
+}
+
+// completeInLanguage asks the model once more, without streaming, when the
+// answer comes back in a different language than requested. Answers that
+// are too short to tell are accepted. A second answer that is still in the
+// wrong language is no better, so the first one is kept.
+func completeInLanguage(ctx context.Context, client *llmClient, lang language, system string, human string, stream func(chunk string) error) (string, error) {
+	answer, err := client.Complete(ctx, system, human, stream)
+	if err != nil || lang.Code == "" {
+		return answer, err
+	}
+	detected, ok := detectLanguage(answer)
+	if !ok || detected.Code == lang.Code {
+		return answer, nil
+	}
+	log.Debug().Str("expected", lang.Name).Str("detected", detected.Name).Msg("message is in the wrong language, asking again")
+	hint := fmt.Sprintf("Your previous answer was in %s. The message must be in %s.\n", detected.Name, lang.Name)
+	retried, err := client.Complete(ctx, system+hint, human, nil)
+	if err != nil {
+		return answer, err
+	}
+	if detected, ok := detectLanguage(retried); ok && detected.Code != lang.Code {
+		log.Debug().Str("expected", lang.Name).Str("detected", detected.Name).Msg("the second message is in the wrong language too, keeping the first")
+		return answer, nil
+	}
+	return retried, nil
+}
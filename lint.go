@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+const lintFixPrompt = `You fix commit messages. Rewrite the commit message you are given so it no longer has the listed problems. Keep its meaning and any trailers. Answer with the commit message only, without a code fence.
+`
+
+// errLintFailed is returned once the problems have been printed
+var errLintFailed = errors.New("commit message has problems")
+
+var trailerRegex = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*): (.+)$`)
+
+// Messages written by git itself are never linted
+var lintSkipPrefixes = []string{"Merge ", "Revert \"", "fixup! ", "squash! ", "amend! "}
+
+// Verbs whose third person form ("adds", "fixes") gives a subject away as
+// not imperative
+var commonVerbs = []string{
+	"add", "allow", "apply", "avoid", "bump", "change", "check", "clean", "convert", "create", "delete", "disable",
+	"document", "drop", "enable", "ensure", "expose", "extract", "fix", "handle", "implement", "improve", "introduce",
+	"load", "make", "merge", "move", "prevent", "refactor", "remove", "rename", "replace", "restore", "return", "revert",
+	"run", "set", "show", "skip", "split", "store", "support", "switch", "update", "upgrade", "use", "validate", "write",
+}
+
+// Imperative verbs that happen to end in "ed"
+var imperativeEdVerbs = []string{"embed", "exceed", "proceed", "seed", "shred", "speed", "succeed"}
+
+type lintIssue struct {
+	Rule    string
+	Message string
+}
+
+type trailer struct {
+	Key   string
+	Value string
+}
+
+// cleanCommitMessage drops what git strips before committing: comment
+// lines, everything below the scissors line and surrounding blank lines
+func cleanCommitMessage(raw string) string {
+	var lines []string
+	for _, line := range strings.Split(raw, "\n") {
+		if strings.HasPrefix(line, "# ------------------------ >8 ------------------------") {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// parseTrailers reads the trailers from the last paragraph of a message,
+// the way git interpret-trailers does
+func parseTrailers(message string) []trailer {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	var trailers []trailer
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(trailers) > 0 {
+			trailers[len(trailers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		match := trailerRegex.FindStringSubmatch(line)
+		if match == nil {
+			return nil
+		}
+		trailers = append(trailers, trailer{Key: match[1], Value: match[2]})
+	}
+	return trailers
+}
+
+func isImperative(word string) bool {
+	word = strings.ToLower(strings.Trim(word, "`'\"()[]:"))
+	switch {
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return false
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		return StringInSlice(word, imperativeEdVerbs)
+	case strings.HasSuffix(word, "ies"):
+		return !StringInSlice(strings.TrimSuffix(word, "ies")+"y", commonVerbs)
+	case strings.HasSuffix(word, "es") && StringInSlice(strings.TrimSuffix(word, "es"), commonVerbs):
+		return false
+	case strings.HasSuffix(word, "s") && StringInSlice(strings.TrimSuffix(word, "s"), commonVerbs):
+		return false
+	}
+	return true
+}
+
+// lintMessage checks a cleaned commit message against the rules
+func lintMessage(message string, config LintConfig) []lintIssue {
+	var issues []lintIssue
+	lines := strings.Split(message, "\n")
+	subject := lines[0]
+	if strings.TrimSpace(subject) == "" {
+		return []lintIssue{{Rule: "subject-empty", Message: "the subject line is empty"}}
+	}
+	for _, prefix := range lintSkipPrefixes {
+		if strings.HasPrefix(subject, prefix) {
+			return nil
+		}
+	}
+
+	description := subject
+	if config.Conventional {
+		header, ok := parseConventionalHeader(subject, message)
+		switch {
+		case !ok:
+			issues = append(issues, lintIssue{Rule: "conventional", Message: "the subject is not in the Conventional Commits format type(scope): description"})
+		case len(config.ConventionalTypes) > 0 && !StringInSlice(header.Type, config.ConventionalTypes):
+			issues = append(issues, lintIssue{Rule: "conventional", Message: fmt.Sprintf("%q is not one of the allowed types: %s", header.Type, strings.Join(config.ConventionalTypes, ", "))})
+		default:
+			description = header.Description
+		}
+		if ok && header.Scope != "" && len(config.Scopes) > 0 && !scopeAllowed(header.Scope, config.Scopes) {
+			issues = append(issues, lintIssue{Rule: "scope", Message: fmt.Sprintf("%q is not one of the allowed scopes: %s", header.Scope, strings.Join(config.Scopes, ", "))})
+		}
+	}
+	if config.Style == "gitmoji" {
+		gitmoji, rest, ok := parseGitmojiSubject(subject, config.Gitmojis)
+		switch {
+		case !ok:
+			issues = append(issues, lintIssue{Rule: "gitmoji", Message: "the subject doesn't start with a gitmoji from the set"})
+		case !strings.HasPrefix(stripVariation(subject), stripVariation(formatGitmoji(gitmoji, config.GitmojiFormat))):
+			issues = append(issues, lintIssue{Rule: "gitmoji", Message: fmt.Sprintf("write the gitmoji as %s", formatGitmoji(gitmoji, config.GitmojiFormat))})
+			description = rest
+		default:
+			description = rest
+		}
+	}
+
+	if length := utf8.RuneCountInString(subject); config.SubjectMaxLength > 0 && length > config.SubjectMaxLength {
+		issues = append(issues, lintIssue{Rule: "subject-max-length", Message: fmt.Sprintf("the subject is %d characters, at most %d are allowed", length, config.SubjectMaxLength)})
+	}
+	if config.Imperative {
+		if words := strings.Fields(description); len(words) > 0 && !isImperative(words[0]) {
+			issues = append(issues, lintIssue{Rule: "imperative", Message: fmt.Sprintf("start the subject with an imperative verb, not %q", words[0])})
+		}
+	}
+	if config.NoTrailingPeriod && strings.HasSuffix(subject, ".") {
+		issues = append(issues, lintIssue{Rule: "no-trailing-period", Message: "the subject ends with a period"})
+	}
+	if body, _ := splitTrailers(message); config.SubjectOnly && strings.Contains(body, "\n") {
+		issues = append(issues, lintIssue{Rule: "subject-only", Message: "the message should only have a subject and trailers"})
+	}
+	if config.BlankLineAfterSubject && len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		issues = append(issues, lintIssue{Rule: "blank-line-after-subject", Message: "the subject must be followed by a blank line"})
+	}
+	if config.BodyWrap > 0 {
+		for i, line := range lines[1:] {
+			// Links, quotes, code and trailers can't be wrapped
+			if utf8.RuneCountInString(line) <= config.BodyWrap || strings.Contains(line, "://") ||
+				strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, ">") || trailerRegex.MatchString(line) {
+				continue
+			}
+			issues = append(issues, lintIssue{Rule: "body-wrap", Message: fmt.Sprintf("line %d is longer than %d characters", i+2, config.BodyWrap)})
+		}
+	}
+
+	trailers := parseTrailers(message)
+	for _, required := range config.RequiredTrailers {
+		found := false
+		for _, t := range trailers {
+			if strings.EqualFold(t.Key, required) {
+				found = true
+			}
+		}
+		if !found {
+			issues = append(issues, lintIssue{Rule: "required-trailers", Message: fmt.Sprintf("the %q trailer is missing", required)})
+		}
+	}
+	if config.RequireTicket && len(config.TicketPatterns) > 0 && findTicket(message, config.TicketPatterns) == "" {
+		issues = append(issues, lintIssue{Rule: "ticket-reference", Message: fmt.Sprintf("no ticket reference matching %s", strings.Join(config.TicketPatterns, " or "))})
+	}
+	return issues
+}
+
+// describe turns the rules into instructions for the model
+func (c LintConfig) describe() string {
+	var rules []string
+	if c.Conventional {
+		rules = append(rules, fmt.Sprintf("Use the Conventional Commits format type(scope): description, with one of these types: %s.", strings.Join(c.ConventionalTypes, ", ")))
+		if len(c.Scopes) > 0 {
+			rules = append(rules, fmt.Sprintf("Only use one of these scopes, or no scope: %s.", strings.Join(c.Scopes, ", ")))
+		}
+	}
+	if c.Style == "gitmoji" {
+		rules = append(rules, "Start the subject with the one gitmoji that best fits the intent of the change, followed by a space. Pick it from this list:\n"+describeGitmojis(c))
+	}
+	if c.SubjectMaxLength > 0 {
+		rules = append(rules, fmt.Sprintf("Keep the subject line at most %d characters.", c.SubjectMaxLength))
+	}
+	if c.Imperative {
+		rules = append(rules, "Write the subject in the imperative mood, e.g. \"Add\" rather than \"Added\" or \"Adds\".")
+	}
+	if c.NoTrailingPeriod {
+		rules = append(rules, "Do not end the subject with a period.")
+	}
+	if c.SubjectOnly {
+		rules = append(rules, "Write only the subject line, without a body.")
+	}
+	if c.BlankLineAfterSubject && !c.SubjectOnly {
+		rules = append(rules, "Leave a blank line between the subject and the body.")
+	}
+	if c.BodyWrap > 0 && !c.SubjectOnly {
+		rules = append(rules, fmt.Sprintf("Wrap the body at %d characters.", c.BodyWrap))
+	}
+	if len(c.RequiredTrailers) > 0 {
+		rules = append(rules, fmt.Sprintf("End with these trailers: %s.", strings.Join(c.RequiredTrailers, ", ")))
+	}
+	if c.RequireTicket && len(c.TicketPatterns) > 0 {
+		rules = append(rules, fmt.Sprintf("Reference a ticket matching the regular expression %s.", strings.Join(c.TicketPatterns, " or ")))
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "Follow these rules:\n- " + strings.Join(rules, "\n- ") + "\n"
+}
+
+// fixMessage asks the model to rewrite a message that has problems
+func fixMessage(ctx context.Context, client *llmClient, message string, issues []lintIssue, config LintConfig) (string, error) {
+	var human strings.Builder
+	human.WriteString(message + "\n\nProblems:\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&human, "- %s\n", issue.Message)
+	}
+	answer, err := client.Complete(ctx, lintFixPrompt+config.describe(), human.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimPrefix(strings.TrimSuffix(answer, "```"), "```")
+	return cleanCommitMessage(answer), nil
+}
+
+// installCommitMsgHook points the repository's commit-msg hook at this
+// binary. An existing hook is only replaced with force.
+func installCommitMsgHook(force bool) (string, error) {
+	hooksDir, err := runGit("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	hookPath := filepath.Join(hooksDir, "commit-msg")
+	if _, err := os.Stat(hookPath); err == nil && !force {
+		return "", fmt.Errorf("%s already exists, use --force to replace it", hookPath)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+		return "", err
+	}
+	hook := fmt.Sprintf("#!/bin/sh\n# Installed by aicommit lint --install-hook\nexec '%s' lint \"$1\"\n", strings.ReplaceAll(executable, "'", `'\''`))
+	return hookPath, os.WriteFile(hookPath, []byte(hook), 0o755)
+}
+
+type lintTarget struct {
+	Name    string
+	File    string
+	Message string
+}
+
+// lintTargets reads a message file, or the commits of a revision or range
+func lintTargets(arg string) ([]lintTarget, error) {
+	if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+		content, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return []lintTarget{{Name: arg, File: arg, Message: cleanCommitMessage(string(content))}}, nil
+	}
+	var extra []string
+	if !strings.Contains(arg, "..") {
+		extra = []string{"--max-count=1"}
+	}
+	commits, err := logCommits(arg, extra...)
+	if err != nil {
+		return nil, err
+	}
+	var targets []lintTarget
+	for _, commit := range commits {
+		message := commit.Subject
+		if commit.Body != "" {
+			message += "\n\n" + commit.Body
+		}
+		targets = append(targets, lintTarget{Name: shortSHA(commit.SHA) + " " + commit.Subject, Message: message})
+	}
+	return targets, nil
+}
+
+func newLintCmd(cdb *CommitDB) *cobra.Command {
+	var fix bool
+	var installHook bool
+	var force bool
+	cmdLint := &cobra.Command{
+		Use:   "lint [file|sha-range]",
+		Short: "Check commit messages against the repository's rules",
+		Long: "Checks a commit message file, as passed to a commit-msg hook, or the commits in a revision range. " +
+			"Rules are configured in the \"lint\" section of " + repoConfigFile + " at the root of the repository.",
+		Args:          cobra.MaximumNArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// This runs from hooks, so errors are printed rather than shown
+			// in the error view
+			err := func() error {
+				if installHook {
+					hookPath, err := installCommitMsgHook(force)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Installed %s\n", hookPath)
+					return nil
+				}
+
+				config, err := loadRepoConfig()
+				if err != nil {
+					return err
+				}
+				if config.Scopes.Strict {
+					scopes, err := loadRepoScopes(config)
+					if err != nil {
+						return err
+					}
+					config.Lint.Scopes = scopes.allowed
+				}
+				arg := "HEAD"
+				if len(args) > 0 {
+					arg = args[0]
+				}
+				targets, err := lintTargets(arg)
+				if err != nil {
+					return err
+				}
+
+				var client *llmClient
+				failed := false
+				for _, target := range targets {
+					issues := lintMessage(target.Message, config.Lint)
+					if len(issues) == 0 {
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "✗ %s\n", target.Name)
+					for _, issue := range issues {
+						fmt.Fprintf(os.Stderr, "    %s: %s\n", issue.Rule, issue.Message)
+					}
+					if !fix {
+						failed = true
+						continue
+					}
+
+					if client == nil {
+						if client, err = loadLLMClient(cdb); err != nil {
+							return err
+						}
+					}
+					fixed, err := fixMessage(cmd.Context(), client, target.Message, issues, config.Lint)
+					if err != nil {
+						return err
+					}
+					if remaining := lintMessage(fixed, config.Lint); len(remaining) > 0 {
+						failed = true
+						fmt.Fprintf(os.Stderr, "  the rewritten message still has %d %s\n", len(remaining), plural(len(remaining), "problem", "problems"))
+					}
+					if target.File == "" {
+						// Rewriting history is left to the user
+						fmt.Printf("Suggested message for %s:\n\n%s\n\n", target.Name, fixed)
+						continue
+					}
+					if err := os.WriteFile(target.File, []byte(fixed+"\n"), 0o644); err != nil {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "  rewrote %s\n", target.File)
+				}
+				if failed {
+					return errLintFailed
+				}
+				return nil
+			}()
+			if err != nil && !errors.Is(err, errLintFailed) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			return err
+		},
+	}
+	cmdLint.Flags().BoolVar(&fix, "fix", false, "let the model rewrite messages with problems")
+	cmdLint.Flags().BoolVar(&installHook, "install-hook", false, "install a commit-msg hook that runs the linter")
+	cmdLint.Flags().BoolVar(&force, "force", false, "replace an existing commit-msg hook")
+	return cmdLint
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/schema"
+)
+
+const commitMessagePrompt = "Generate a short commit message. "
+
+// commitMessageSystemPrompt is the prompt for writing a commit message,
+// including the rules the linter will check it against
+func commitMessageSystemPrompt(config RepoConfig, ticket string, lang language) string {
+	return commitMessagePrompt + config.Lint.describe() + ticketPrompt(ticket) + trailersPrompt + languagePrompt(lang)
+}
+
+// llmClient is what the commands outside the main TUI use to talk to the
+// configured provider. It applies the same timeouts and retries as the TUI.
+type llmClient struct {
+	provider string
+	model    string
+	apiKey   string
+	limits   RequestLimits
+	onRetry  func(RetryStatus)
+	language string // the profile's message language setting
+}
+
+// loadLLMClient builds a client from the stored settings and keyring.
+func loadLLMClient(cdb *CommitDB) (*llmClient, error) {
+	userSettings, err := cdb.GetUserSettings()
+	if err != nil {
+		return nil, err
+	}
+	if userSettings.AiProvider == nil || userSettings.ModelSelection == nil || *userSettings.ModelSelection == "" {
+		return nil, errors.New("no AI provider configured, run `aicommit` first to pick one")
+	}
+	apiKey, err := getProviderAPIKey(*userSettings.AiProvider)
+	if err != nil {
+		return nil, classifyKeyringError(err)
+	}
+	return &llmClient{
+		provider: *userSettings.AiProvider,
+		model:    *userSettings.ModelSelection,
+		apiKey:   apiKey,
+		limits:   requestLimitsFromSettings(userSettings),
+		language: derefString(userSettings.Language),
+	}, nil
+}
+
+// Complete sends a system and a human message and returns the answer. When
+// stream is set it receives the answer chunk by chunk as well.
+func (c *llmClient) Complete(ctx context.Context, system string, human string, stream func(chunk string) error) (string, error) {
+	if c.provider != "openai" {
+		return "", fmt.Errorf("provider %q is not supported", c.provider)
+	}
+	llm, err := openai.NewChat(
+		openai.WithModel(c.model),
+		openai.WithToken(c.apiKey),
+		openai.WithHTTPClient(newRetryingDoer(c.limits, c.onRetry)),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	chats := []schema.ChatMessage{
+		schema.SystemChatMessage{Content: system},
+		schema.HumanChatMessage{Content: human},
+	}
+	var options []llms.CallOption
+	if stream != nil {
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return stream(string(chunk))
+		}))
+	}
+	completion, err := llm.Call(ctx, chats, options...)
+	if err != nil {
+		return "", classifyProviderError(err)
+	}
+	return strings.TrimSpace(completion.Content), nil
+}
+
+// extractJSON returns the outermost JSON object in a model answer, which is
+// often wrapped in prose or a code fence.
+func extractJSON(answer string) (string, error) {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("model did not answer with JSON: %q", answer)
+	}
+	return answer[start : end+1], nil
+}
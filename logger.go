@@ -24,7 +24,7 @@ func initLogger() {
 			Caller:     1,
 			TimeField:  "date",
 			TimeFormat: "2006-01-02T15:04:05.999Z07:00",
-			Writer:     &log.IOWriter{os.Stdout},
+			Writer:     &log.IOWriter{Writer: os.Stdout},
 		}
 	}
 }
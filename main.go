@@ -5,11 +5,9 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -20,9 +18,6 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/phuslu/log"
 	"github.com/spf13/cobra"
-	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
-	"github.com/tmc/langchaingo/schema"
 	"github.com/zalando/go-keyring"
 
 	dbmodel "aicommit/.gen/model"
@@ -30,6 +25,8 @@ import (
 
 var (
 	mainContentStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFFFFF"))
+	errorTitleStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF5F87"))
+	helpStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color("#626262"))
 )
 
 type ScreenView int
@@ -38,19 +35,31 @@ const (
 	NoView            ScreenView = -1
 	SettingsView      ScreenView = 0 // 0
 	CommitMessageView ScreenView = 1 // null, \0
+	ErrorView         ScreenView = 2
+	SelectView        ScreenView = 3
+	CoAuthorView      ScreenView = 4
 )
 
 type model struct {
 	quitting bool
 	view     ScreenView
 	cdb      *CommitDB
+	options  startOptions
 
 	genMessageState struct {
-		sub           chan string // where we'll receive activity notifications
-		responses     int         // how many responses we've received
+		sub           chan responseMsg // where we'll receive activity notifications
+		retries       chan retryMsg    // where we'll hear about retried requests
+		generation    int              // numbers the requests, so late answers to cancelled ones are dropped
+		responses     int              // how many responses we've received
 		loading       bool
+		amending      bool // git commit --amend is running, with the commit hooks
 		spinner       spinner.Model
 		commitMessage *strings.Builder
+		diff          string             // what the message was generated from, recorded when amending
+		diffContext   diffContext        // the context that diff was taken with
+		cancel        context.CancelFunc // cancels the in-flight request, if any
+		limits        RequestLimits
+		status        string
 	}
 
 	settingsState struct {
@@ -58,27 +67,63 @@ type model struct {
 		hasProviderAPIKey bool
 		userSettings      dbmodel.UserSettings
 		form              *huh.Form
+		catalog           ModelCatalog
+	}
+
+	errState struct {
+		err  *AppError
+		from ScreenView // the view the error happened in
+	}
+
+	selectState struct {
+		diff     string // the diff the selection was made on
+		files    []FileDiff
+		units    []splitUnit
+		rows     []selectRow
+		selected map[string]bool // by unit ID
+		cursor   int
+		stage    bool // stage exactly the selection before generating
+		active   bool // generate from the selection instead of the whole diff
+		status   string
+	}
+
+	coAuthorState struct {
+		roster   []dbmodel.TeamMember
+		selected []dbmodel.TeamMember // added as Co-authored-by trailers
+		form     *huh.Form
 	}
 
 	terminalWidth  int
 	terminalHeight int
 }
 
-func getTeaProgram(db *CommitDB) *tea.Program {
+// startOptions are the command line options of the main command
+type startOptions struct {
+	limitOverrides func(*RequestLimits)
+	amend          bool   // describe HEAD^ against the index and amend HEAD in place
+	ticket         string // overrides the ticket found in the branch name
+	language       string // overrides the language from the repo config and profile
+	subjectOnly    bool   // generate only a subject line, whatever the repo config says
+}
+
+func getTeaProgram(db *CommitDB, options startOptions) *tea.Program {
 	keyring.Delete("crowdlog-aicommit-openai", "anon")
 	userSettings, err := db.GetUserSettings()
 	if err != nil {
 		panic(err)
 	}
+	catalog, err := LoadModelCatalog(db)
+	if err != nil {
+		panic(err)
+	}
 	hasProviderAPIKey := false
 	providerAPIKey := ""
 
 	if userSettings.AiProvider != nil {
-		service := "crowdlog-aicommit-" + *userSettings.AiProvider
-		user := "anon"
-		key, apiKeyErr := keyring.Get(service, user)
+		key, apiKeyErr := getProviderAPIKey(*userSettings.AiProvider)
 		if apiKeyErr != nil {
-			log.Info().Err(apiKeyErr)
+			// An unavailable keyring surfaces when saving the settings
+			log.Info().Err(classifyKeyringError(apiKeyErr)).Msg("could not read provider API key")
 			hasProviderAPIKey = false
 		}
 		if key != "" {
@@ -96,47 +141,204 @@ func getTeaProgram(db *CommitDB) *tea.Program {
 		log.Debug().Msg(err.Error())
 		view = SettingsView
 	}
-	form := NewSettingsForm(newSettingsFormArgs{addProviderKeyInput: !hasProviderAPIKey})
+	form := NewSettingsForm(newSettingsFormArgs{addProviderKeyInput: !hasProviderAPIKey, catalog: catalog, language: derefString(userSettings.Language)})
+	limits := requestLimitsFromSettings(userSettings)
+	if options.limitOverrides != nil {
+		options.limitOverrides(&limits)
+	}
 
 	return tea.NewProgram(model{
-		cdb: db,
+		cdb:     db,
+		options: options,
 		settingsState: struct {
 			providerAPIKey    string
 			hasProviderAPIKey bool
 			userSettings      dbmodel.UserSettings
 			form              *huh.Form
+			catalog           ModelCatalog
 		}{
 			providerAPIKey:    providerAPIKey,
 			hasProviderAPIKey: hasProviderAPIKey,
 			userSettings:      userSettings,
 			form:              form,
+			catalog:           catalog,
 		},
 		genMessageState: struct {
-			sub           chan string
+			sub           chan responseMsg
+			retries       chan retryMsg
+			generation    int
 			responses     int
 			loading       bool
+			amending      bool
 			spinner       spinner.Model
 			commitMessage *strings.Builder
+			diff          string
+			diffContext   diffContext
+			cancel        context.CancelFunc
+			limits        RequestLimits
+			status        string
 		}{
-			sub:           make(chan string),
+			sub:           make(chan responseMsg),
+			retries:       make(chan retryMsg),
 			responses:     0,
 			loading:       false,
 			spinner:       spinner.New(),
 			commitMessage: &strings.Builder{},
+			limits:        limits,
 		},
 		view: view,
 	})
 }
 
+// newErrorModel is used when we fail before there is anything else to show,
+// e.g. when the database can't be opened.
+func newErrorModel(err error) model {
+	m := model{view: ErrorView}
+	m.errState.err = asAppError(err)
+	m.errState.from = NoView
+	return m
+}
+
 func (m model) Init() tea.Cmd {
-	return tea.Batch(
-		waitForActivity(m.genMessageState.sub), // wait for activity
-		textinput.Blink,
-		m.settingsState.form.Init(),
+	listen := tea.Batch(
+		waitForChunk(m.genMessageState.sub), // wait for activity
+		waitForRetry(m.genMessageState.retries),
 	)
+	if m.settingsState.form == nil {
+		return listen
+	}
+	return tea.Batch(listen, textinput.Blink, m.settingsState.form.Init())
+}
+
+// showError switches to the error view. The error stays set so the program
+// exits non-zero if the user quits from there.
+func (m model) showError(err error) (model, tea.Cmd) {
+	m.errState.err = asAppError(err)
+	m.errState.from = m.view
+	m.genMessageState.loading = false
+	m.genMessageState.amending = false
+	m.genMessageState.status = ""
+	m.view = ErrorView
+	return m, tea.ClearScreen
+}
+
+// startGeneration kicks off a new request, cancelling any in-flight one.
+func (m model) startGeneration() (model, tea.Cmd) {
+	if m.genMessageState.cancel != nil {
+		m.genMessageState.cancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.genMessageState.cancel = cancel
+	m.genMessageState.generation++
+	m.genMessageState.responses = 0
+	m.genMessageState.loading = true
+	m.genMessageState.status = ""
+	m.genMessageState.commitMessage.Reset()
+	m.genMessageState.diff = ""
+	m.errState.err = nil
+	m.view = CommitMessageView
+	return m, tea.Batch(generateMessage(ctx, &m), m.genMessageState.spinner.Tick, tea.ClearScreen)
+}
+
+// openSettings shows a fresh settings form that asks for the API key again.
+func (m model) openSettings() (model, tea.Cmd) {
+	m.settingsState.form = NewSettingsForm(newSettingsFormArgs{
+		addProviderKeyInput: true,
+		catalog:             m.settingsState.catalog,
+		language:            derefString(m.settingsState.userSettings.Language),
+	})
+	m.errState.err = nil
+	m.view = SettingsView
+	return m, tea.Batch(m.settingsState.form.Init(), tea.ClearScreen)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(errMsg); ok {
+		return m.showError(msg.err)
+	}
+	// The generation runs on whichever view is open, and its listeners
+	// have to be re-armed after every message
+	switch msg := msg.(type) {
+	case amendedMsg:
+		m.genMessageState.amending = false
+		m.genMessageState.status = "Amended, HEAD is now " + shortSHA(msg.sha)
+		return m, nil
+	case responseMsg:
+		// Chunks of a cancelled request can still be queued
+		if msg.generation == m.genMessageState.generation {
+			m.genMessageState.responses++                                   // record external activity
+			m.genMessageState.commitMessage.WriteString(msg.messageContent) // update the model
+		}
+		return m, waitForChunk(m.genMessageState.sub) // wait for next event
+	case retryMsg:
+		if m.genMessageState.loading && msg.generation == m.genMessageState.generation {
+			m.genMessageState.status = msg.String()
+		}
+		return m, waitForRetry(m.genMessageState.retries)
+	case spinner.TickMsg:
+		var genMessageSpinnerCmd tea.Cmd
+		if m.genMessageState.loading {
+			m.genMessageState.spinner, genMessageSpinnerCmd = m.genMessageState.spinner.Update(msg)
+		}
+		return m, tea.Batch(genMessageSpinnerCmd)
+	case genMsg:
+		if msg.generation != m.genMessageState.generation {
+			return m, nil
+		}
+		if msg.msgType == "Error" {
+			return m.showError(msg.err)
+		}
+		if msg.msgType == "Done" {
+			m.genMessageState.loading = false
+			m.genMessageState.status = msg.status
+			m.genMessageState.commitMessage.Reset()
+			m.genMessageState.commitMessage.WriteString(msg.Content)
+			m.genMessageState.diff = msg.diff
+			m.genMessageState.diffContext = msg.diffContext
+			return m, nil
+		}
+		if msg.msgType == "Cancelled" {
+			m.genMessageState.loading = false
+			m.genMessageState.status = "Cancelled"
+			return m, nil
+		}
+		return m, nil
+	}
+	if m.view == ErrorView {
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			m.terminalWidth = msg.Width
+			m.terminalHeight = msg.Height
+			return m, nil
+		case tea.KeyMsg:
+			action := m.errState.err.Action()
+			switch msg.String() {
+			case "q", "esc", "ctrl+c":
+				m.quitting = true
+				return m, tea.Quit
+			case "r":
+				if action == ActionNone || m.cdb == nil {
+					return m, nil
+				}
+				if m.errState.from == SettingsView {
+					return m.openSettings()
+				}
+				return m.startGeneration()
+			case "s":
+				if action == ActionNone || m.cdb == nil {
+					return m, nil
+				}
+				return m.openSettings()
+			}
+		}
+		return m, nil
+	}
+	if m.view == SelectView {
+		return m.updateSelectView(msg)
+	}
+	if m.view == CoAuthorView {
+		return m.updateCoAuthorView(msg)
+	}
 	if m.view == SettingsView {
 		var cmds []tea.Cmd
 		form, cmd := m.settingsState.form.Update(msg)
@@ -146,11 +348,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		if m.settingsState.form.State == huh.StateCompleted {
-			println("Form is completed")
 			err := m.SaveSettings()
 			if err != nil {
-				println("Error saving settings:", err.Error())
-				return m, nil
+				return m.showError(err)
 			}
 			m.view = CommitMessageView
 			return m, tea.Batch(cmds...)
@@ -166,35 +366,47 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		case tea.KeyMsg:
 			switch msg.String() {
-			case "q", "esc", "ctrl+c":
+			case "esc":
+				if m.genMessageState.loading {
+					m.genMessageState.cancel()
+					m.genMessageState.loading = false
+					m.genMessageState.status = "Cancelled"
+					return m, nil
+				}
+				m.quitting = true
+				return m, tea.Quit
+			case "q", "ctrl+c":
+				if m.genMessageState.cancel != nil {
+					m.genMessageState.cancel()
+				}
 				m.quitting = true
 				return m, tea.Quit
 			case "enter":
-				m.genMessageState.responses = 0
-				m.genMessageState.loading = true
-				m.genMessageState.commitMessage.Reset()
-				return m, tea.Batch(generateMessage(&m), m.genMessageState.spinner.Tick, tea.ClearScreen)
+				if m.genMessageState.amending {
+					return m, nil
+				}
+				return m.startGeneration()
+			case "p":
+				if m.genMessageState.loading || m.options.amend {
+					return m, nil
+				}
+				return m.openSelection()
+			case "o":
+				if m.genMessageState.loading {
+					return m, nil
+				}
+				return m.openCoAuthors()
+			case "a":
+				message := strings.TrimSpace(m.genMessageState.commitMessage.String())
+				if !m.options.amend || m.genMessageState.loading || m.genMessageState.amending || message == "" || m.genMessageState.diff == "" {
+					return m, nil
+				}
+				m.genMessageState.amending = true
+				m.genMessageState.status = "Amending"
+				return m, amendHead(m.cdb, message, m.genMessageState.diff, m.genMessageState.diffContext)
 			default:
 				return m, nil
 			}
-		case responseMsg:
-			m.genMessageState.responses++                                   // record external activity
-			m.genMessageState.commitMessage.WriteString(msg.messageContent) // update the model
-			return m, waitForActivity(m.genMessageState.sub)                // wait for next event
-		case spinner.TickMsg:
-			var genMessageSpinnerCmd tea.Cmd
-			if m.genMessageState.loading {
-				m.genMessageState.spinner, genMessageSpinnerCmd = m.genMessageState.spinner.Update(msg)
-			}
-			return m, tea.Batch(genMessageSpinnerCmd)
-		case genMsg:
-			if msg.msgType == "Done" {
-				m.genMessageState.loading = false
-				m.genMessageState.commitMessage.Reset()
-				m.genMessageState.commitMessage.WriteString(msg.Content)
-				return m, nil
-			}
-			return m, nil
 		default:
 			return m, nil
 		}
@@ -217,9 +429,47 @@ func (m model) View() string {
 		return m.settingsState.form.View()
 	}
 
+	if m.view == SelectView {
+		return m.viewSelectView()
+	}
+
+	if m.view == CoAuthorView {
+		return m.viewCoAuthorView()
+	}
+
+	if m.view == ErrorView {
+		appErr := m.errState.err
+		var keys []string
+		switch appErr.Action() {
+		case ActionRetry:
+			keys = append(keys, "r retry", "s settings")
+		case ActionSettings:
+			keys = append(keys, "s settings", "r retry")
+		}
+		if m.cdb == nil {
+			keys = nil
+		}
+		keys = append(keys, "q quit")
+		return renderError(appErr, keys, m.terminalWidth)
+	}
+
 	if m.view == CommitMessageView {
 		commitMessage := m.genMessageState.commitMessage.String()
-		s := mainContentStyle.Width(m.terminalWidth).Render(fmt.Sprintf("\n %s Events received: %d\n\n Press any key to exit\n %s", m.genMessageState.spinner.View(), m.genMessageState.responses, commitMessage))
+		help := "Press enter to generate, p to pick changes, o to add co-authors, q to exit"
+		if m.options.amend {
+			help = "Amending HEAD. Press enter to generate, a to amend, o to add co-authors, q to exit"
+		}
+		if m.genMessageState.loading {
+			help = "Press esc to cancel, q to exit"
+		}
+		if m.selectState.active {
+			help = fmt.Sprintf("Describing %d of %d changes. %s", len(m.selectedIDs()), len(m.selectState.units), help)
+		}
+		status := ""
+		if m.genMessageState.status != "" {
+			status = fmt.Sprintf(" (%s)", m.genMessageState.status)
+		}
+		s := mainContentStyle.Width(m.terminalWidth).Render(fmt.Sprintf("\n %s Events received: %d%s\n\n %s\n %s", m.genMessageState.spinner.View(), m.genMessageState.responses, status, help, commitMessage))
 		if m.quitting {
 			s += "\n"
 		}
@@ -233,41 +483,116 @@ func main() {
 	initialize := true
 	cdb, err := getCommitDBFactory(initialize)
 	if err != nil {
-		println("Error downloading and installing SQLite:", err.Error())
-		return
+		showFatalError(err)
+		os.Exit(1)
 	}
 
+	var timeout time.Duration
+	var maxRetries int
+	var options startOptions
 	var cmdAICommit = &cobra.Command{
 		Use:   "start",
 		Short: "Generate commit message using AI",
-		Run: func(cmd *cobra.Command, args []string) {
-			p := getTeaProgram(cdb)
-			if _, err := p.Run(); err != nil {
+		// Errors have already been shown in the error view
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options.limitOverrides = func(limits *RequestLimits) {
+				if cmd.Flags().Changed("timeout") {
+					limits.Timeout = timeout
+				}
+				if cmd.Flags().Changed("max-retries") {
+					limits.MaxRetries = maxRetries
+				}
+			}
+			p := getTeaProgram(cdb, options)
+			finalModel, err := p.Run()
+			if err != nil {
 				fmt.Println("could not start program:", err)
 				os.Exit(1)
 			}
+			if m, ok := finalModel.(model); ok && m.errState.err != nil {
+				return m.errState.err
+			}
+			return nil
 		},
 	}
-	cmdAICommit.Execute()
+	cmdAICommit.Flags().DurationVar(&timeout, "timeout", defaultRequestTimeout, "timeout for each request to the AI provider")
+	cmdAICommit.Flags().IntVar(&maxRetries, "max-retries", defaultMaxRetries, "how often to retry rate limited or failed requests")
+	cmdAICommit.Flags().BoolVar(&options.amend, "amend", false, "describe HEAD together with the staged changes and amend it")
+	cmdAICommit.PersistentFlags().StringVar(&options.ticket, "ticket", "", "ticket ID to reference instead of the one in the branch name (needs a ticket placement in .aicommit.json)")
+	cmdAICommit.PersistentFlags().BoolVar(&options.subjectOnly, "subject-only", false, "write only a subject line")
+	cmdAICommit.PersistentFlags().StringVar(&options.language, "language", "", "language to write messages in, e.g. German or ja, or auto to follow the history")
+	cmdAICommit.AddCommand(newModelsCmd(cdb))
+	cmdAICommit.AddCommand(newSplitCmd(cdb))
+	cmdAICommit.AddCommand(newPRCmd(cdb))
+	cmdAICommit.AddCommand(newChangelogCmd(cdb))
+	cmdAICommit.AddCommand(newReleaseCmd(cdb))
+	cmdAICommit.AddCommand(newLintCmd(cdb))
+	cmdAICommit.AddCommand(newRewordCmd(cdb))
+	cmdAICommit.AddCommand(newTeamCmd(cdb))
+	cmdAICommit.AddCommand(newExplainCmd(cdb))
+	cmdAICommit.AddCommand(newReviewCmd(cdb))
+	cmdAICommit.AddCommand(newServeCmd(cdb))
+	cmdAICommit.AddCommand(newIndexCmd(cdb))
+	if err := cmdAICommit.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// renderError is the body of every error view: what happened, how to fix it
+// and which keys do something about it.
+func renderError(appErr *AppError, keys []string, width int) string {
+	return mainContentStyle.Width(width).Render(fmt.Sprintf(
+		"\n %s\n\n %s\n\n %s\n\n %s\n",
+		errorTitleStyle.Render(appErr.Title()),
+		appErr.Err.Error(),
+		appErr.Fix(),
+		helpStyle.Render(strings.Join(keys, " • ")),
+	))
+}
+
+// showFatalError reports an error that happened before the TUI could start.
+func showFatalError(err error) {
+	if !log.IsTerminal(os.Stdout.Fd()) {
+		appErr := asAppError(err)
+		fmt.Fprintf(os.Stderr, "%s\n%s\n", appErr.Error(), appErr.Fix())
+		return
+	}
+	if _, runErr := tea.NewProgram(newErrorModel(err)).Run(); runErr != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 }
 
 // ---------------- User Settings ----------------
 
 type newSettingsFormArgs struct {
 	addProviderKeyInput bool
+	catalog             ModelCatalog
+	language            string // the current setting, shown for editing
 }
 
 func NewSettingsForm(args newSettingsFormArgs) *huh.Form {
+	// Models from providers we can't generate with yet are left out of the list
+	var modelOptions []huh.Option[string]
+	for _, info := range args.catalog.Models("") {
+		if !StringInSlice(info.Provider, supportedProviders) {
+			continue
+		}
+		label := fmt.Sprintf("%s (%dk context)", info.Name, info.ContextWindow/1000)
+		modelOptions = append(modelOptions, huh.NewOption(label, info.Name))
+	}
+
 	// Define the base groups
 	groups := []*huh.Group{
 		huh.NewGroup(
 			huh.NewSelect[string]().
 				Key("provider").
-				Options(huh.NewOptions("openai", "more coming soon...")...).
+				Options(huh.NewOptions(args.catalog.Providers()...)...).
 				Title("Choose your AI Provider").
 				Validate(func(t string) error {
-					if t != "openai" {
-						return errors.New("only openai is supported at this time")
+					if !StringInSlice(t, supportedProviders) {
+						return fmt.Errorf("only %s is supported at this time", strings.Join(supportedProviders, ", "))
 					}
 					return nil
 				}),
@@ -275,9 +600,16 @@ func NewSettingsForm(args newSettingsFormArgs) *huh.Form {
 		huh.NewGroup(
 			huh.NewSelect[string]().
 				Key("model").
-				Options(huh.NewOptions("gpt-4-1106-preview", "gpt-3.5-turbo-1106")...).
+				Options(modelOptions...).
 				Title("Choose your model"),
 		),
+		huh.NewGroup(
+			huh.NewInput().
+				Key("language").
+				Title("Which language should commit messages be written in?").
+				Description("A name like German or a code like ja. auto follows the repository's history, empty leaves it to the model.").
+				Value(&args.language),
+		),
 	}
 
 	// Conditionally add the provider key input field
@@ -293,11 +625,10 @@ func NewSettingsForm(args newSettingsFormArgs) *huh.Form {
 }
 
 func hasCompleteSettings(userSettings dbmodel.UserSettings, hasProviderAPIKey bool) error {
-	var validProviders = []string{"openai"}
 	if userSettings.AiProvider == nil {
 		return errors.New("no AI provider selected")
 	}
-	if userSettings.AiProvider != nil && !StringInSlice(*userSettings.AiProvider, validProviders) {
+	if userSettings.AiProvider != nil && !StringInSlice(*userSettings.AiProvider, supportedProviders) {
 		return errors.New("invalid AI provider selected")
 	}
 	if !hasProviderAPIKey {
@@ -313,15 +644,15 @@ func (m *model) SaveSettings() error {
 	provider := m.settingsState.form.GetString("provider")
 	model := m.settingsState.form.GetString("model")
 	providerKey := m.settingsState.form.GetString("provider-key")
-	service := "crowdlog-aicommit-" + provider
-	user := "anon"
-	err := keyring.Set(service, user, providerKey)
+	err := setProviderAPIKey(provider, providerKey)
 	if err != nil {
-		return err
+		return classifyKeyringError(err)
 	}
+	language := strings.TrimSpace(m.settingsState.form.GetString("language"))
 	userSettings := dbmodel.UserSettings{
 		AiProvider:     &provider,
 		ModelSelection: &model,
+		Language:       &language,
 	}
 	m.settingsState.providerAPIKey = providerKey
 	_, err = m.cdb.UpdateUserSettings(userSettings)
@@ -336,12 +667,25 @@ func (m *model) SaveSettings() error {
 	return nil
 }
 
+func providerKeyringService(provider string) string {
+	return "crowdlog-aicommit-" + provider
+}
+
+func getProviderAPIKey(provider string) (string, error) {
+	return keyring.Get(providerKeyringService(provider), "anon")
+}
+
+func setProviderAPIKey(provider string, key string) error {
+	return keyring.Set(providerKeyringService(provider), "anon", key)
+}
+
 // ---------------- Commit Message Generation ----------------
 
 // A message used to indicate that activity has occurred. In the real world (for
 // example, chat) this would contain actual data.
 type responseMsg struct {
 	messageContent string
+	generation     int // the request it belongs to, in the main TUI
 }
 
 // A command that waits for the activity on a channel.
@@ -352,104 +696,191 @@ func waitForActivity(stream chan string) tea.Cmd {
 	}
 }
 
-func getGitDiff() (string, error) {
-	cmd := exec.Command("git", "diff", "-U10", "head")
-	output, err := cmd.Output()
+// waitForChunk is waitForActivity for chunks that are already tagged with
+// their request
+func waitForChunk(chunks chan responseMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-chunks
+	}
+}
+
+// Sent when a request to the AI provider failed and is about to be retried.
+type retryMsg struct {
+	RetryStatus
+	generation int
+}
+
+func waitForRetry(retries chan retryMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-retries
+	}
+}
+
+// getGitDiff is every change to tracked files, with as much context as the
+// token budget allows
+func getGitDiff(budget int) (string, diffContext, error) {
+	diff, usedContext, err := contextDiff(budget, "HEAD")
 	if err != nil {
-		return "", err
+		return "", usedContext, err
 	}
-	return string(output), nil
+	if strings.TrimSpace(diff) == "" {
+		return "", usedContext, newAppError(ErrNoChanges, errors.New("git diff is empty"))
+	}
+	return diff, usedContext, nil
+}
+
+// getStagedDiff is what would be committed right now
+func getStagedDiff(budget int) (string, diffContext, error) {
+	diff, usedContext, err := contextDiff(budget, "--cached")
+	if err != nil {
+		return "", usedContext, err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return "", usedContext, newAppError(ErrNoChanges, errors.New("nothing is staged"))
+	}
+	return diff, usedContext, nil
 }
 
 type genMsg struct {
-	Content string
-	msgType string
+	Content    string
+	msgType    string // Done, Cancelled or Error
+	status     string // shown next to a finished message, e.g. when it spans scopes
+	err        error
+	generation int
+
+	diff        string // the diff the message was generated from
+	diffContext diffContext
 }
 
-func generateMessage(m *model) tea.Cmd {
+// Sent when HEAD was amended
+type amendedMsg struct {
+	sha string
+}
 
+// amendHead runs amendCommit in the background, since the commit hooks can take
+// a while
+func amendHead(cdb *CommitDB, message string, diff string, usedContext diffContext) tea.Cmd {
 	return func() tea.Msg {
-		gitDiff, err := getGitDiff()
+		sha, err := amendCommit(cdb, message, diff, usedContext)
 		if err != nil {
-			println("Error getting git diff:", err.Error())
-			return nil
+			return errMsg{err}
+		}
+		return amendedMsg{sha: sha}
+	}
+}
+
+// Sent when something failed that the user should see in the error view.
+type errMsg struct {
+	err error
+}
+
+func generateMessage(ctx context.Context, m *model) tea.Cmd {
+
+	useSelection := m.selectState.active
+	amend := m.options.amend
+	ticketOverride := m.options.ticket
+	coAuthors := m.coAuthorState.selected
+	languageOverride := m.options.language
+	subjectOnly := m.options.subjectOnly
+	selectedPatch := ""
+	if useSelection {
+		selectedPatch = m.selectedPatch()
+	}
+	generation := m.genMessageState.generation
+
+	// Errors come back as genMsg too, so the error of a request that was
+	// cancelled in the meantime is dropped like its answer
+	failed := func(err error) tea.Msg {
+		if ctx.Err() != nil {
+			return genMsg{msgType: "Cancelled", generation: generation}
 		}
+		return genMsg{msgType: "Error", err: err, generation: generation}
+	}
 
-		dateCreated := time.Now()
-		diffStructuredJson := ""
+	return func() tea.Msg {
 		model := m.settingsState.userSettings.ModelSelection
-		aiProvider := "openai"
-		promptBytes, err := json.Marshal([]string{"Generate a short commit message."})
+		modelInfo, _ := m.settingsState.catalog.Lookup(*m.settingsState.userSettings.AiProvider, *model)
+		budget := diffTokenBudget(modelInfo)
+
+		var gitDiff string
+		var usedContext diffContext
+		var err error
+		switch {
+		case amend:
+			gitDiff, usedContext, err = getAmendDiff(budget)
+		case useSelection:
+			// The selection is made on the -U10 diff
+			gitDiff, usedContext = selectedPatch, defaultDiffContext
+		default:
+			gitDiff, usedContext, err = getGitDiff(budget)
+		}
 		if err != nil {
-			println("Error marshalling prompts:", err.Error())
-			return nil
+			return failed(err)
 		}
-		prompts := string(promptBytes)
 
-		var gitDiffRow = &dbmodel.Diff{
-			Diff:               &gitDiff,
-			DateCreated:        &dateCreated,
-			DiffStructuredJSON: &diffStructuredJson,
-			Model:              model,
-			AiProvider:         &aiProvider,
-			Prompts:            &prompts,
-		}
-		initialize := false
-		cdb, err := getCommitDBFactory(initialize)
-		if err != nil {
-			println("Error downloading and installing SQLite:", err.Error())
-			return nil
+		request := messageRequest{
+			Diff:            gitDiff,
+			Context:         usedContext,
+			Ticket:          ticketOverride,
+			Language:        languageOverride,
+			ProfileLanguage: derefString(m.settingsState.userSettings.Language),
+			SubjectOnly:     subjectOnly,
+			CoAuthors:       coAuthors,
 		}
-		_, err = cdb.InsertDiff(*gitDiffRow)
-		if err != nil {
-			println("Error inserting diff:", err.Error())
-			return nil
+		if amend {
+			if request.CurrentMessage, err = headMessage(); err != nil {
+				return failed(err)
+			}
 		}
 
-		main2()
-
-		structuredDiff, err := cdb.GetDiff()
+		initialize := false
+		cdb, err := getCommitDBFactory(initialize)
 		if err != nil {
-			println("Error getting git diff:", err.Error())
-			return nil
+			return failed(err)
 		}
 
-		if structuredDiff.DiffStructuredJSON == nil {
-			println("Error getting structured diff:", err.Error())
+		generated, err := genMessage(ctx, cdb, modelInfo, request, m)
+		if ctx.Err() != nil {
+			return genMsg{msgType: "Cancelled", generation: generation}
 		}
-
-		content, err := genMessage(gitDiff, m)
 		if err != nil {
-			println("Error generating commit message using AI:", err.Error())
-			return nil
+			return failed(err)
 		}
 		return genMsg{
-			Content: content.Content,
-			msgType: "Done",
+			Content:     generated.Message,
+			msgType:     "Done",
+			status:      generated.Status,
+			generation:  generation,
+			diff:        gitDiff,
+			diffContext: usedContext,
 		}
 	}
 }
 
-func genMessage(gitDiff string, m *model) (*schema.AIChatMessage, error) {
-	llm, err := openai.NewChat(openai.WithModel(*m.settingsState.userSettings.ModelSelection), openai.WithToken(m.settingsState.providerAPIKey))
-	if err != nil {
-		return nil, err
-	}
-
-	var chats = []schema.ChatMessage{
-		schema.SystemChatMessage{Content: "Generate a short commit message. "},
-		schema.HumanChatMessage{Content: gitDiff},
-	}
-	completion, err := llm.Call(context.Background(), chats, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
-		m.genMessageState.sub <- string(chunk)
-		return nil
-	}))
-
-	if err != nil {
-		println("Error calling AI:", err.Error())
-		return nil, err
+func genMessage(ctx context.Context, cdb *CommitDB, modelInfo ModelInfo, request messageRequest, m *model) (generatedMessage, error) {
+	sub := m.genMessageState.sub
+	retries := m.genMessageState.retries
+	generation := m.genMessageState.generation
+	client := &llmClient{
+		provider: *m.settingsState.userSettings.AiProvider,
+		model:    *m.settingsState.userSettings.ModelSelection,
+		apiKey:   m.settingsState.providerAPIKey,
+		limits:   m.genMessageState.limits,
+		onRetry: func(status RetryStatus) {
+			select {
+			case retries <- retryMsg{RetryStatus: status, generation: generation}:
+			case <-ctx.Done():
+			}
+		},
 	}
-
-	return completion, nil
-
+	return writeCommitMessage(ctx, cdb, client, modelInfo, request, func(chunk string) error {
+		// Nobody reads the channel once the request is cancelled or the
+		// program quits, so don't block on it
+		select {
+		case sub <- responseMsg{messageContent: chunk, generation: generation}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
 }
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE
+  model_catalog (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    provider TEXT NOT NULL,
+    name TEXT NOT NULL,
+    context_window INTEGER,
+    max_output_tokens INTEGER,
+    tokenizer TEXT,
+    input_price_per_1k REAL,
+    output_price_per_1k REAL,
+    supports_streaming BOOLEAN,
+    supports_tools BOOLEAN,
+    source TEXT,
+    date_created TIMESTAMP,
+    UNIQUE (provider, name)
+  );
+
+ALTER TABLE diff ADD COLUMN context_window INTEGER;
+
+ALTER TABLE diff ADD COLUMN tokenizer TEXT;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS model_catalog;
+
+ALTER TABLE diff DROP COLUMN context_window;
+
+ALTER TABLE diff DROP COLUMN tokenizer;
+-- +goose StatementEnd
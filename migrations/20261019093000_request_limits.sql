@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE user_settings ADD COLUMN request_timeout_seconds INTEGER;
+
+ALTER TABLE user_settings ADD COLUMN max_retries INTEGER;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_settings DROP COLUMN request_timeout_seconds;
+
+ALTER TABLE user_settings DROP COLUMN max_retries;
+-- +goose StatementEnd
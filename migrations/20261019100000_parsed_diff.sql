@@ -0,0 +1,8 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE diff ADD COLUMN parsed_diff_json TEXT;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE diff DROP COLUMN parsed_diff_json;
+-- +goose StatementEnd
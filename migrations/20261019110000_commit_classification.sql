@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE commit_classification (
+    sha TEXT PRIMARY KEY,
+    section TEXT,
+    entry TEXT,
+    breaking BOOLEAN,
+    model TEXT,
+    date_created TIMESTAMP
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE commit_classification;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE commits ADD COLUMN sha TEXT;
+ALTER TABLE commits ADD COLUMN amended_sha TEXT;
+ALTER TABLE commits ADD COLUMN previous_message TEXT;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE commits DROP COLUMN previous_message;
+ALTER TABLE commits DROP COLUMN amended_sha;
+ALTER TABLE commits DROP COLUMN sha;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE commit_explanation (
+    sha TEXT NOT NULL,
+    depth TEXT NOT NULL,
+    explanation TEXT,
+    model TEXT,
+    date_created TIMESTAMP,
+    PRIMARY KEY (sha, depth)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE commit_explanation;
+-- +goose StatementEnd
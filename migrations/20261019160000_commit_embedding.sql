@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE commit_embedding (
+    sha TEXT NOT NULL,
+    model TEXT NOT NULL,
+    message TEXT,
+    vector BLOB,
+    date_created TIMESTAMP,
+    PRIMARY KEY (sha, model)
+);
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE commit_embedding;
+-- +goose StatementEnd
@@ -0,0 +1,8 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE diff ADD COLUMN diff_context TEXT;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE diff DROP COLUMN diff_context;
+-- +goose StatementEnd
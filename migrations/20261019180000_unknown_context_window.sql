@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE model_catalog SET context_window = NULL, max_output_tokens = NULL
+WHERE source = 'provider' AND context_window = 4096 AND max_output_tokens = 4096;
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+UPDATE model_catalog SET context_window = 4096, max_output_tokens = 4096
+WHERE source = 'provider' AND context_window IS NULL AND max_output_tokens IS NULL;
+-- +goose StatementEnd
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const (
+	ModelSourceBuiltin  = "builtin"
+	ModelSourceProvider = "provider"
+	ModelSourceUser     = "user"
+)
+
+// defaultTokenizer is used for models we know nothing about, e.g. ones only
+// seen in a provider's model listing.
+const defaultTokenizer = "cl100k_base"
+
+// defaultContextWindow is deliberately conservative so that unknown models
+// still get their diffs chunked rather than rejected by the provider.
+const defaultContextWindow = 4096
+
+// ModelInfo describes a model the tool can generate messages with.
+type ModelInfo struct {
+	Provider          string  `json:"provider"`
+	Name              string  `json:"name"`
+	ContextWindow     int     `json:"context_window"`
+	MaxOutputTokens   int     `json:"max_output_tokens"`
+	Tokenizer         string  `json:"tokenizer"`
+	InputPricePer1K   float64 `json:"input_price_per_1k"`  // USD per 1K prompt tokens
+	OutputPricePer1K  float64 `json:"output_price_per_1k"` // USD per 1K completion tokens
+	SupportsStreaming bool    `json:"supports_streaming"`
+	SupportsTools     bool    `json:"supports_tools"`
+	Source            string  `json:"source"`
+}
+
+// builtinModels is the catalog shipped with the binary. Entries in the
+// model_catalog table override these by provider and name.
+var builtinModels = []ModelInfo{
+	{Provider: "openai", Name: "gpt-4-1106-preview", ContextWindow: 128000, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.01, OutputPricePer1K: 0.03, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-4-vision-preview", ContextWindow: 128000, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.01, OutputPricePer1K: 0.03, SupportsStreaming: true},
+	{Provider: "openai", Name: "gpt-4", ContextWindow: 8192, MaxOutputTokens: 8192, Tokenizer: "cl100k_base", InputPricePer1K: 0.03, OutputPricePer1K: 0.06, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-4-32k", ContextWindow: 32768, MaxOutputTokens: 32768, Tokenizer: "cl100k_base", InputPricePer1K: 0.06, OutputPricePer1K: 0.12, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-4-0613", ContextWindow: 8192, MaxOutputTokens: 8192, Tokenizer: "cl100k_base", InputPricePer1K: 0.03, OutputPricePer1K: 0.06, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-4-32k-0613", ContextWindow: 32768, MaxOutputTokens: 32768, Tokenizer: "cl100k_base", InputPricePer1K: 0.06, OutputPricePer1K: 0.12, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-4-0314", ContextWindow: 8192, MaxOutputTokens: 8192, Tokenizer: "cl100k_base", InputPricePer1K: 0.03, OutputPricePer1K: 0.06, SupportsStreaming: true},
+	{Provider: "openai", Name: "gpt-4-32k-0314", ContextWindow: 32768, MaxOutputTokens: 32768, Tokenizer: "cl100k_base", InputPricePer1K: 0.06, OutputPricePer1K: 0.12, SupportsStreaming: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-1106", ContextWindow: 16385, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.001, OutputPricePer1K: 0.002, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.0015, OutputPricePer1K: 0.002, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-16k", ContextWindow: 16385, MaxOutputTokens: 16385, Tokenizer: "cl100k_base", InputPricePer1K: 0.003, OutputPricePer1K: 0.004, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-instruct", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.0015, OutputPricePer1K: 0.002, SupportsStreaming: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-0613", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.0015, OutputPricePer1K: 0.002, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-16k-0613", ContextWindow: 16385, MaxOutputTokens: 16385, Tokenizer: "cl100k_base", InputPricePer1K: 0.003, OutputPricePer1K: 0.004, SupportsStreaming: true, SupportsTools: true},
+	{Provider: "openai", Name: "gpt-3.5-turbo-0301", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "cl100k_base", InputPricePer1K: 0.0015, OutputPricePer1K: 0.002, SupportsStreaming: true},
+	{Provider: "openai", Name: "text-davinci-003", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "p50k_base", InputPricePer1K: 0.02, OutputPricePer1K: 0.02, SupportsStreaming: true},
+	{Provider: "openai", Name: "text-davinci-002", ContextWindow: 4096, MaxOutputTokens: 4096, Tokenizer: "p50k_base", InputPricePer1K: 0.02, OutputPricePer1K: 0.02, SupportsStreaming: true},
+	{Provider: "openai", Name: "code-davinci-002", ContextWindow: 8001, MaxOutputTokens: 8001, Tokenizer: "p50k_base", SupportsStreaming: true},
+}
+
+// supportedProviders are the providers we can actually generate with. The
+// catalog may list more, but the settings form only accepts these.
+var supportedProviders = []string{"openai"}
+
+// ModelCatalog is the merged view of builtin, provider-listed and user-added
+// models.
+type ModelCatalog struct {
+	models []ModelInfo
+}
+
+// LoadModelCatalog merges the builtin catalog with the rows stored in the
+// model_catalog table. Stored rows win over builtin ones.
+func LoadModelCatalog(cdb *CommitDB) (ModelCatalog, error) {
+	stored, err := cdb.GetModelCatalog()
+	if err != nil {
+		return ModelCatalog{}, err
+	}
+
+	byKey := map[string]ModelInfo{}
+	var order []string
+	add := func(info ModelInfo) {
+		key := info.Provider + "/" + info.Name
+		if _, ok := byKey[key]; !ok {
+			order = append(order, key)
+		}
+		byKey[key] = info
+	}
+	for _, info := range builtinModels {
+		info.Source = ModelSourceBuiltin
+		add(info)
+	}
+	for _, row := range stored {
+		add(modelInfoFromRow(row))
+	}
+
+	catalog := ModelCatalog{}
+	for _, key := range order {
+		catalog.models = append(catalog.models, byKey[key])
+	}
+	return catalog, nil
+}
+
+// Models returns every model in the catalog, optionally limited to one
+// provider.
+func (c ModelCatalog) Models(provider string) []ModelInfo {
+	var models []ModelInfo
+	for _, info := range c.models {
+		if provider == "" || info.Provider == provider {
+			models = append(models, info)
+		}
+	}
+	return models
+}
+
+// Providers returns the distinct providers in the catalog, sorted.
+func (c ModelCatalog) Providers() []string {
+	var providers []string
+	for _, info := range c.models {
+		if !StringInSlice(info.Provider, providers) {
+			providers = append(providers, info.Provider)
+		}
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+// Lookup finds a model by provider and name. Unknown models get conservative
+// defaults so callers can always budget tokens.
+func (c ModelCatalog) Lookup(provider string, name string) (ModelInfo, bool) {
+	for _, info := range c.models {
+		if info.Provider == provider && info.Name == name {
+			return info, true
+		}
+	}
+	return defaultModelInfo(provider, name, ""), false
+}
+
+func defaultModelInfo(provider string, name string, source string) ModelInfo {
+	return ModelInfo{
+		Provider:          provider,
+		Name:              name,
+		ContextWindow:     defaultContextWindow,
+		MaxOutputTokens:   defaultContextWindow,
+		Tokenizer:         defaultTokenizer,
+		SupportsStreaming: true,
+		Source:            source,
+	}
+}
+
+func modelInfoFromRow(row dbmodel.ModelCatalog) ModelInfo {
+	info := defaultModelInfo(row.Provider, row.Name, ModelSourceUser)
+	if row.ContextWindow != nil {
+		info.ContextWindow = int(*row.ContextWindow)
+	}
+	if row.MaxOutputTokens != nil {
+		info.MaxOutputTokens = int(*row.MaxOutputTokens)
+	}
+	if row.Tokenizer != nil && *row.Tokenizer != "" {
+		info.Tokenizer = *row.Tokenizer
+	}
+	if row.InputPricePer1k != nil {
+		info.InputPricePer1K = *row.InputPricePer1k
+	}
+	if row.OutputPricePer1k != nil {
+		info.OutputPricePer1K = *row.OutputPricePer1k
+	}
+	if row.SupportsStreaming != nil {
+		info.SupportsStreaming = *row.SupportsStreaming
+	}
+	if row.SupportsTools != nil {
+		info.SupportsTools = *row.SupportsTools
+	}
+	if row.Source != nil && *row.Source != "" {
+		info.Source = *row.Source
+	}
+	return info
+}
+
+// toRow stores the model. Limits that aren't known are stored as NULL, so
+// they fall back to the defaults when read instead of looking measured.
+func (info ModelInfo) toRow() dbmodel.ModelCatalog {
+	contextWindow := int32(info.ContextWindow)
+	maxOutputTokens := int32(info.MaxOutputTokens)
+	dateCreated := time.Now()
+	row := dbmodel.ModelCatalog{
+		Provider:          info.Provider,
+		Name:              info.Name,
+		ContextWindow:     &contextWindow,
+		MaxOutputTokens:   &maxOutputTokens,
+		Tokenizer:         &info.Tokenizer,
+		InputPricePer1k:   &info.InputPricePer1K,
+		OutputPricePer1k:  &info.OutputPricePer1K,
+		SupportsStreaming: &info.SupportsStreaming,
+		SupportsTools:     &info.SupportsTools,
+		Source:            &info.Source,
+		DateCreated:       &dateCreated,
+	}
+	if contextWindow <= 0 {
+		row.ContextWindow = nil
+	}
+	if maxOutputTokens <= 0 {
+		row.MaxOutputTokens = nil
+	}
+	return row
+}
+
+// ---------------- Provider model listings ----------------
+
+// modelListers fetch the model ids a provider currently offers. Providers
+// without a listing endpoint are simply absent.
+var modelListers = map[string]func(ctx context.Context, apiKey string) ([]string, error){
+	"openai": listOpenAIModels,
+}
+
+var openAIModelsURL = "https://api.openai.com/v1/models"
+
+func listOpenAIModels(ctx context.Context, apiKey string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, openAIModelsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing openai models: unexpected status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, m := range body.Data {
+		// The listing also contains embedding, audio and image models.
+		if strings.HasPrefix(m.ID, "gpt-") {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids, nil
+}
+
+// RefreshModelCatalog asks the provider which models exist and stores the
+// ones the catalog doesn't know about yet. It returns the newly added models.
+func RefreshModelCatalog(ctx context.Context, cdb *CommitDB, provider string, apiKey string) ([]ModelInfo, error) {
+	lister, ok := modelListers[provider]
+	if !ok {
+		return nil, fmt.Errorf("provider %q has no model listing endpoint", provider)
+	}
+	ids, err := lister(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := LoadModelCatalog(cdb)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []ModelInfo
+	for _, id := range ids {
+		if _, known := catalog.Lookup(provider, id); known {
+			continue
+		}
+		// The listing doesn't say how large the context window is
+		info := defaultModelInfo(provider, id, ModelSourceProvider)
+		info.ContextWindow, info.MaxOutputTokens = 0, 0
+		if _, err := cdb.UpsertModel(info.toRow()); err != nil {
+			return added, err
+		}
+		added = append(added, info)
+	}
+	return added, nil
+}
+
+// ---------------- CLI ----------------
+
+func newModelsCmd(cdb *CommitDB) *cobra.Command {
+	cmdModels := &cobra.Command{
+		Use:   "models",
+		Short: "Inspect and manage the model catalog",
+	}
+
+	var listProvider string
+	cmdList := &cobra.Command{
+		Use:   "list",
+		Short: "List known models with their limits and pricing",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			catalog, err := LoadModelCatalog(cdb)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROVIDER\tMODEL\tCONTEXT\tMAX OUTPUT\tTOKENIZER\t$/1K IN\t$/1K OUT\tSTREAMING\tTOOLS\tSOURCE")
+			for _, info := range catalog.Models(listProvider) {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%.4f\t%.4f\t%t\t%t\t%s\n",
+					info.Provider, info.Name, info.ContextWindow, info.MaxOutputTokens, info.Tokenizer,
+					info.InputPricePer1K, info.OutputPricePer1K, info.SupportsStreaming, info.SupportsTools, info.Source)
+			}
+			return w.Flush()
+		},
+	}
+	cmdList.Flags().StringVar(&listProvider, "provider", "", "only list models from this provider")
+
+	var refreshProvider string
+	cmdRefresh := &cobra.Command{
+		Use:   "refresh",
+		Short: "Fetch the provider's model listing and add unknown models",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			apiKey, err := getProviderAPIKey(refreshProvider)
+			if err != nil {
+				return fmt.Errorf("no API key stored for %s: %w", refreshProvider, err)
+			}
+			added, err := RefreshModelCatalog(cmd.Context(), cdb, refreshProvider, apiKey)
+			if err != nil {
+				return err
+			}
+			for _, info := range added {
+				fmt.Printf("added %s/%s\n", info.Provider, info.Name)
+			}
+			fmt.Printf("%d new models\n", len(added))
+			return nil
+		},
+	}
+	cmdRefresh.Flags().StringVar(&refreshProvider, "provider", "openai", "provider to refresh")
+
+	info := ModelInfo{Source: ModelSourceUser}
+	cmdAdd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add or override a model in the catalog",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info.Name = args[0]
+			if info.ContextWindow <= 0 {
+				return fmt.Errorf("--context-window must be positive")
+			}
+			if info.MaxOutputTokens <= 0 {
+				info.MaxOutputTokens = info.ContextWindow
+			}
+			_, err := cdb.UpsertModel(info.toRow())
+			return err
+		},
+	}
+	cmdAdd.Flags().StringVar(&info.Provider, "provider", "openai", "provider serving the model")
+	cmdAdd.Flags().IntVar(&info.ContextWindow, "context-window", 0, "context window in tokens")
+	cmdAdd.Flags().IntVar(&info.MaxOutputTokens, "max-output-tokens", 0, "maximum completion tokens (defaults to the context window)")
+	cmdAdd.Flags().StringVar(&info.Tokenizer, "tokenizer", defaultTokenizer, "tiktoken encoding name")
+	cmdAdd.Flags().Float64Var(&info.InputPricePer1K, "input-price", 0, "USD per 1K prompt tokens")
+	cmdAdd.Flags().Float64Var(&info.OutputPricePer1K, "output-price", 0, "USD per 1K completion tokens")
+	cmdAdd.Flags().BoolVar(&info.SupportsStreaming, "streaming", true, "model supports streaming responses")
+	cmdAdd.Flags().BoolVar(&info.SupportsTools, "tools", false, "model supports tool/function calls")
+	cmdAdd.MarkFlagRequired("context-window")
+
+	cmdModels.AddCommand(cmdList, cmdRefresh, cmdAdd)
+	return cmdModels
+}
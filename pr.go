@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/atotto/clipboard"
+	"github.com/spf13/cobra"
+)
+
+const prChunkPrompt = "Summarise this part of a pull request diff in a few short bullet points. Only describe what changed, not how good it is."
+
+const prPrompt = `You write pull request descriptions. You get the commits on a branch and its changes, either as a diff or as summaries of parts of the diff.
+Answer with JSON only, in this shape:
+{"title": "...", "summary": "...", "changes": ["..."], "testing": "...", "risk": "..."}
+- title: one line under 72 characters, no trailing period
+- summary: two or three sentences on what the branch does and why
+- changes: one short bullet per notable change
+- testing: how the change was or should be tested, based on the tests and commits you can see
+- risk: what could break and what reviewers should look at closely
+`
+
+const prRepoTemplatePrompt = `The repository has a pull request template, given below. Also fill it in and put the Markdown in a "body" field, keeping its headings, checklists and comments in place.
+`
+
+// defaultPRTemplate renders the description. A repository template filled
+// in by the model replaces the sections.
+const defaultPRTemplate = `# {{.Title}}
+
+{{if .Body}}{{.Body}}{{else}}## Summary
+
+{{.Summary}}
+
+## Changes
+
+{{range .Changes}}- {{.}}
+{{end}}
+## Testing
+
+{{.Testing}}
+
+## Risk
+
+{{.Risk}}{{end}}
+`
+
+// prTemplatePaths are the places GitHub looks for a pull request template
+var prTemplatePaths = []string{
+	".github/pull_request_template.md",
+	".github/PULL_REQUEST_TEMPLATE.md",
+	"pull_request_template.md",
+	"PULL_REQUEST_TEMPLATE.md",
+	"docs/pull_request_template.md",
+	"docs/PULL_REQUEST_TEMPLATE.md",
+}
+
+type prDescription struct {
+	Title   string   `json:"title"`
+	Summary string   `json:"summary"`
+	Changes []string `json:"changes"`
+	Testing string   `json:"testing"`
+	Risk    string   `json:"risk"`
+	Body    string   `json:"body"`
+}
+
+// defaultPRBase picks the branch a pull request would usually target: the
+// remote's default branch, or a local main or master.
+func defaultPRBase() (string, error) {
+	if ref, err := runGit("symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil && ref != "" {
+		return ref, nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if _, err := runGit("rev-parse", "--verify", "--quiet", branch); err == nil {
+			return branch, nil
+		}
+	}
+	return "", errors.New("could not find a base branch, pass one as an argument")
+}
+
+// findPRTemplate returns the repository's pull request template, if any
+func findPRTemplate() string {
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return ""
+	}
+	for _, templatePath := range prTemplatePaths {
+		content, err := os.ReadFile(filepath.Join(root, templatePath))
+		if err == nil && strings.TrimSpace(string(content)) != "" {
+			return string(content)
+		}
+	}
+	return ""
+}
+
+// describePR gathers the branch and asks the model for a description.
+// Diffs too large for one request go through the chunker and each chunk is
+// summarised first.
+func describePR(ctx context.Context, cdb *CommitDB, client *llmClient, base string, repoTemplate string) (prDescription, error) {
+	commits, err := logCommits(base + "..HEAD")
+	if err != nil {
+		return prDescription{}, err
+	}
+	if len(commits) == 0 {
+		return prDescription{}, newAppError(ErrNoChanges, fmt.Errorf("no commits between %s and HEAD", base))
+	}
+	gitDiff, err := runGitRaw("", "diff", "-U10", base+"...HEAD")
+	if err != nil {
+		return prDescription{}, err
+	}
+
+	system := prPrompt
+	if repoTemplate != "" {
+		system += prRepoTemplatePrompt
+	}
+	catalog, err := LoadModelCatalog(cdb)
+	if err != nil {
+		return prDescription{}, err
+	}
+	modelInfo, _ := catalog.Lookup(client.provider, client.model)
+	chunks, err := chunkDiff(cdb, gitDiff, defaultDiffContext, CondenseDiff(ParseGitDiff(gitDiff)), modelInfo, []string{system, prChunkPrompt})
+	if err != nil {
+		return prDescription{}, err
+	}
+
+	var human strings.Builder
+	human.WriteString("Commits:\n")
+	for _, commit := range commits {
+		fmt.Fprintf(&human, "- %s\n", commit.Subject)
+		if commit.Body != "" {
+			fmt.Fprintf(&human, "  %s\n", strings.ReplaceAll(commit.Body, "\n", "\n  "))
+		}
+	}
+	if len(chunks) == 1 {
+		human.WriteString("\nDiff:\n" + chunkText(chunks[0]))
+	} else {
+		for i, chunk := range chunks {
+			fmt.Fprintf(os.Stderr, "Summarising part %d of %d\n", i+1, len(chunks))
+			summary, err := client.Complete(ctx, prChunkPrompt, chunkText(chunk), nil)
+			if err != nil {
+				return prDescription{}, err
+			}
+			fmt.Fprintf(&human, "\nChanges, part %d of %d:\n%s\n", i+1, len(chunks), summary)
+		}
+	}
+	if repoTemplate != "" {
+		human.WriteString("\nPull request template:\n" + repoTemplate)
+	}
+
+	answer, err := client.Complete(ctx, system, human.String(), nil)
+	if err != nil {
+		return prDescription{}, err
+	}
+	raw, err := extractJSON(answer)
+	if err != nil {
+		return prDescription{}, err
+	}
+	var desc prDescription
+	if err := json.Unmarshal([]byte(raw), &desc); err != nil {
+		return prDescription{}, fmt.Errorf("could not read the pull request description: %w", err)
+	}
+	if repoTemplate == "" {
+		desc.Body = ""
+	}
+	return desc, nil
+}
+
+func renderPR(desc prDescription, templateText string) (string, error) {
+	tmpl, err := template.New("pr").Parse(templateText)
+	if err != nil {
+		return "", fmt.Errorf("could not parse the template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, desc); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func newPRCmd(cdb *CommitDB) *cobra.Command {
+	var templateFile string
+	var outputFile string
+	var toClipboard bool
+	cmdPR := &cobra.Command{
+		Use:   "pr [base]",
+		Short: "Write a pull request title and description for the current branch",
+		Long: "Describes the commits and changes in base...HEAD as Markdown. The base defaults to the remote's default branch. " +
+			"A pull request template in the repository is filled in when present.",
+		Args:          cobra.MaximumNArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				templateText := defaultPRTemplate
+				if templateFile != "" {
+					content, err := os.ReadFile(templateFile)
+					if err != nil {
+						return err
+					}
+					templateText = string(content)
+				}
+				base := ""
+				if len(args) > 0 {
+					base = args[0]
+				} else {
+					var err error
+					if base, err = defaultPRBase(); err != nil {
+						return err
+					}
+				}
+
+				client, err := loadLLMClient(cdb)
+				if err != nil {
+					return err
+				}
+				client.onRetry = func(status RetryStatus) {
+					fmt.Fprintln(os.Stderr, status.String())
+				}
+				desc, err := describePR(cmd.Context(), cdb, client, base, findPRTemplate())
+				if err != nil {
+					return err
+				}
+				output, err := renderPR(desc, templateText)
+				if err != nil {
+					return err
+				}
+
+				if outputFile != "" {
+					if err := os.WriteFile(outputFile, []byte(output), 0o644); err != nil {
+						return err
+					}
+				}
+				if toClipboard {
+					if err := clipboard.WriteAll(output); err != nil {
+						return fmt.Errorf("could not copy to the clipboard: %w", err)
+					}
+					fmt.Fprintln(os.Stderr, "Copied to the clipboard")
+				}
+				if outputFile == "" && !toClipboard {
+					fmt.Print(output)
+				}
+				return nil
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+	cmdPR.Flags().StringVar(&templateFile, "template", "", "Go text/template file to render the description with")
+	cmdPR.Flags().StringVarP(&outputFile, "output", "o", "", "write the description to this file")
+	cmdPR.Flags().BoolVar(&toClipboard, "clipboard", false, "copy the description to the clipboard")
+	return cmdPR
+}
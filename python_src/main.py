@@ -1,7 +1,6 @@
 import json
 import tiktoken
 from concurrent.futures import ThreadPoolExecutor
-import re
 
 from typing import List, TypedDict, cast
 import sqlite3
@@ -13,27 +12,6 @@ class FileDiff(TypedDict, total=False):
     file_name: str
 
 
-openai_models = {
-    "gpt-4-1106-preview": 128000,
-    "gpt-4-vision-preview": 128000,
-    "gpt-4": 8192,
-    "gpt-4-32k": 32768,
-    "gpt-4-0613": 8192,
-    "gpt-4-32k-0613": 32768,
-    "gpt-4-0314": 8192,
-    "gpt-4-32k-0314": 32768,
-    "gpt-3.5-turbo-1106": 16385,
-    "gpt-3.5-turbo": 4096,
-    "gpt-3.5-turbo-16k": 16385,
-    "gpt-3.5-turbo-instruct": 4096,
-    "gpt-3.5-turbo-0613": 4096,
-    "gpt-3.5-turbo-16k-0613": 16385,
-    "gpt-3.5-turbo-0301": 4096,
-    "text-davinci-003": 4096,
-    "text-davinci-002": 4096,
-    "code-davinci-002": 8001,
-}
-
 def main():
     try:
                 # Connect to the SQLite database
@@ -41,7 +19,7 @@ def main():
         cursor = conn.cursor()
 
         # Query to select the row with the ID 'diff'
-        query = "SELECT * FROM diff WHERE id = 'diff'"
+        query = "SELECT id, diff, date_created, diff_structured_json, model, ai_provider, prompts, context_window, tokenizer, parsed_diff_json FROM diff WHERE id = 'diff'"
         cursor.execute(query)
 
         # Fetch the row
@@ -58,7 +36,10 @@ def main():
                 'diff_structured_json': row[3],
                 'model': row[4],
                 'ai_provider': row[5],
-                'prompts': json.loads(row[6])  # Deserialize the JSON string
+                'prompts': json.loads(row[6]),  # Deserialize the JSON string
+                'context_window': row[7],
+                'tokenizer': row[8],
+                'parsed_diff': json.loads(row[9]),
             }
         else:
             row_dict = {}
@@ -66,7 +47,10 @@ def main():
         split_gitdiff_args = SplitGitDiffArgs(
             diff_string=row_dict['diff'],
             model=row_dict['model'],
-            prompts=row_dict['prompts']
+            prompts=row_dict['prompts'],
+            context_window=row_dict['context_window'],
+            tokenizer=row_dict['tokenizer'],
+            parsed_diff=row_dict['parsed_diff'],
         )
         test = split_gitdiff(split_gitdiff_args)
         json_str = json.dumps(test, indent=4)
@@ -107,40 +91,41 @@ def count_tokens_on_string(string, encoder: tiktoken.Encoding):
     return len(encoder.encode(string))
 
 
-def getFileExtension(file_diff):
-    return file_diff.split("b/")[1].split(".")[1]
+def get_file_diffs(parsed_diff) -> List[FileDiff]:
+    # Files arrive already parsed and condensed on the Go side, see CondenseDiff
+    results: List[FileDiff] = []
+    for parsed in parsed_diff.get("files") or []:
+        file_name = parsed.get("new_path") or parsed.get("old_path") or "unknown"
+        base_name = file_name.rsplit("/", 1)[-1]
+        extension = f".{base_name.rsplit('.', 1)[-1]}" if "." in base_name else ""
 
+        lines = list(parsed.get("header") or [])
+        for hunk in parsed.get("hunks") or []:
+            lines.append(hunk["header"])
+            lines.extend(hunk.get("lines") or [])
 
-def get_file_diffs(diff_text) -> List[FileDiff]:
-    # Splitting the diff text into individual file diffs
-    file_diffs = diff_text.split("\ndiff --git")
-    pattern = r"^\+\+\+ [ab]/([a-zA-Z0-9_./-]+\.[a-zA-Z0-9_]+)"
+        file_diff = cast(
+            FileDiff,
+            {
+                "extension": extension,
+                "file_name": file_name,
+                "file_diff": "\n".join(lines),
+            },
+        )
+        results.append(file_diff)
 
-    results: List[FileDiff] = []
-    for diff_block in file_diffs:
-        if diff_block.strip():
-            # Adding 'diff --git' back to the diff block, except for the first split which already lacks it
-            diff_block_with_prefix = (
-                "diff --git" + diff_block if diff_block != file_diffs[0] else diff_block
-            )
-
-            # Using a more specific regex pattern to match file paths only in the diff header lines
-            match = re.search(pattern, diff_block_with_prefix, re.MULTILINE)
-            if match:
-                file_name = match.group(1)
-                extension = file_name.split(".")[-1]
-            else:
-                file_name = "unknown"
-                extension = "unknown"
-            file_diff = cast(
-                FileDiff,
-                {
-                    "extension": f".{extension}",
-                    "file_name": file_name,
-                    "file_diff": diff_block_with_prefix,
-                },
-            )
-            results.append(file_diff)
+    # Lockfiles, binaries and generated files only contribute a summary line
+    summaries = parsed_diff.get("summaries") or []
+    if summaries:
+        summary_diff = cast(
+            FileDiff,
+            {
+                "extension": "",
+                "file_name": "summaries",
+                "file_diff": "\n".join(f"- {summary}" for summary in summaries),
+            },
+        )
+        results.append(summary_diff)
     return results
 
 
@@ -190,13 +175,18 @@ class SplitGitDiffArgs(TypedDict):
     diff_string: str
     model: str
     prompts: List[str]
+    # Both come from the Go model catalog
+    context_window: int
+    tokenizer: str
+    # A CondensedDiff serialised by Go
+    parsed_diff: dict
 
 def split_gitdiff(args: SplitGitDiffArgs):
     # Get the encoding
-    enc = tiktoken.encoding_for_model(args['model'])
+    enc = tiktoken.get_encoding(args['tokenizer'])
 
     # Split the diff string into separate file diffs
-    file_diffs = get_file_diffs(args['diff_string'])
+    file_diffs = get_file_diffs(args['parsed_diff'])
 
     with ThreadPoolExecutor() as executor:
         # Schedule tasks for count_tokens_for_file_diff
@@ -226,7 +216,7 @@ def split_gitdiff(args: SplitGitDiffArgs):
                 # Handle exceptions
                 print(f"An error occurred: {e}")
 
-    token_limit = openai_models[args['model']] - sum(prompts_token_counts)
+    token_limit = args['context_window'] - sum(prompts_token_counts)
 
     # Initialize variables
     result_groups: List[List[FileDiff]] = []
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var semverTagRegex = regexp.MustCompile(`^(v?)(\d+)\.(\d+)\.(\d+)(?:[-+].*)?$`)
+
+type semver struct {
+	Prefix string
+	Major  int
+	Minor  int
+	Patch  int
+}
+
+// parseSemverTag reads tags like v1.2.3 or 1.2.3-rc.1. Pre-release and
+// build suffixes are dropped.
+func parseSemverTag(tag string) (semver, bool) {
+	match := semverTagRegex.FindStringSubmatch(tag)
+	if match == nil {
+		return semver{}, false
+	}
+	major, _ := strconv.Atoi(match[2])
+	minor, _ := strconv.Atoi(match[3])
+	patch, _ := strconv.Atoi(match[4])
+	return semver{Prefix: match[1], Major: major, Minor: minor, Patch: patch}, true
+}
+
+func (v semver) String() string {
+	return fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+}
+
+type releaseBump int
+
+const (
+	bumpPatch releaseBump = iota
+	bumpMinor
+	bumpMajor
+)
+
+func (b releaseBump) String() string {
+	switch b {
+	case bumpMajor:
+		return "major"
+	case bumpMinor:
+		return "minor"
+	}
+	return "patch"
+}
+
+// next applies a bump. Before 1.0.0 breaking changes only bump the minor
+// version, as semver allows.
+func (v semver) next(bump releaseBump) semver {
+	if bump == bumpMajor && v.Major == 0 {
+		bump = bumpMinor
+	}
+	switch bump {
+	case bumpMajor:
+		return semver{Prefix: v.Prefix, Major: v.Major + 1}
+	case bumpMinor:
+		return semver{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor + 1}
+	}
+	return semver{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+type releaseSuggestion struct {
+	From           string
+	Current        semver
+	Next           semver
+	Bump           releaseBump
+	Reasons        []string
+	Entries        []changelogEntry
+	RemovedSymbols []string
+}
+
+// lastSemverTag is the newest semver tag reachable from HEAD
+func lastSemverTag() (string, semver, bool) {
+	out, err := runGit("tag", "--merged", "HEAD", "--sort=-v:refname")
+	if err != nil {
+		return "", semver{}, false
+	}
+	for _, tag := range strings.Split(out, "\n") {
+		if version, ok := parseSemverTag(strings.TrimSpace(tag)); ok {
+			return strings.TrimSpace(tag), version, true
+		}
+	}
+	return "", semver{}, false
+}
+
+// suggestRelease classifies the commits since the last tag like the
+// changelog does and checks the Go packages for removed exported symbols.
+func suggestRelease(ctx context.Context, cdb *CommitDB, from string) (releaseSuggestion, error) {
+	suggestion := releaseSuggestion{Current: semver{Prefix: "v"}}
+	if from == "" {
+		if tag, version, ok := lastSemverTag(); ok {
+			suggestion.From, suggestion.Current = tag, version
+		}
+	} else {
+		suggestion.From = from
+		if version, ok := parseSemverTag(from); ok {
+			suggestion.Current = version
+		}
+	}
+
+	revRange := "HEAD"
+	if suggestion.From != "" {
+		revRange = suggestion.From + "..HEAD"
+	}
+	commits, err := logCommits(revRange, "--no-merges")
+	if err != nil {
+		return suggestion, err
+	}
+	if len(commits) == 0 {
+		return suggestion, newAppError(ErrNoChanges, fmt.Errorf("no commits since %s", suggestion.From))
+	}
+	repoConfig, err := loadRepoConfig()
+	if err != nil {
+		return suggestion, err
+	}
+	suggestion.Entries, err = classifyCommits(ctx, cdb, commits, repoConfig.Lint.Gitmojis)
+	if err != nil {
+		return suggestion, err
+	}
+	if suggestion.From != "" {
+		suggestion.RemovedSymbols, err = removedGoSymbols(suggestion.From, "HEAD")
+		if err != nil {
+			return suggestion, err
+		}
+	}
+
+	var breaking, added, fixed, other int
+	for _, entry := range suggestion.Entries {
+		switch {
+		case entry.Breaking:
+			breaking++
+		case entry.Section == "Added":
+			added++
+		case entry.Section == "Fixed" || entry.Section == "Security":
+			fixed++
+		case entry.Section != changelogSkip:
+			other++
+		}
+	}
+
+	suggestion.Bump = bumpPatch
+	if breaking > 0 {
+		suggestion.Bump = bumpMajor
+		suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("%d breaking %s", breaking, plural(breaking, "change", "changes")))
+	}
+	if len(suggestion.RemovedSymbols) > 0 {
+		suggestion.Bump = bumpMajor
+		suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("%d exported Go %s removed: %s", len(suggestion.RemovedSymbols),
+			plural(len(suggestion.RemovedSymbols), "symbol", "symbols"), strings.Join(suggestion.RemovedSymbols, ", ")))
+	}
+	if added > 0 {
+		suggestion.Bump = max(suggestion.Bump, bumpMinor)
+		suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("%d new %s", added, plural(added, "feature", "features")))
+	}
+	if fixed > 0 {
+		suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("%d %s", fixed, plural(fixed, "fix", "fixes")))
+	}
+	if other > 0 {
+		suggestion.Reasons = append(suggestion.Reasons, fmt.Sprintf("%d other %s", other, plural(other, "change", "changes")))
+	}
+	if len(suggestion.Reasons) == 0 {
+		suggestion.Reasons = append(suggestion.Reasons, "only maintenance commits")
+	}
+	if suggestion.Bump == bumpMajor && suggestion.Current.Major == 0 {
+		suggestion.Reasons = append(suggestion.Reasons, "still below 1.0.0, so breaking changes bump the minor version")
+	}
+	suggestion.Next = suggestion.Current.next(suggestion.Bump)
+	return suggestion, nil
+}
+
+// removedGoSymbols lists exported symbols of importable Go packages that
+// exist at from but not at to. Main, internal and test code is not API.
+// Members of a removed type are covered by the type.
+func removedGoSymbols(from string, to string) ([]string, error) {
+	out, err := runGit("diff", "--name-only", "--no-renames", from, to, "--", "*.go")
+	if err != nil {
+		return nil, err
+	}
+	dirs := map[string]bool{}
+	for _, file := range strings.Split(out, "\n") {
+		if file == "" || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		dir := path.Dir(file)
+		if isNonAPIDir(dir) {
+			continue
+		}
+		dirs[dir] = true
+	}
+
+	var removed []string
+	for dir := range dirs {
+		before := goPackageAPIAt(from, dir)
+		after := goPackageAPIAt(to, dir)
+		for _, change := range compareGoAPI(dir, before.Symbols, after.Symbols, isImportable(dir, before.Name)) {
+			if change.Change != "removed" || !change.Breaking {
+				continue
+			}
+			if owner, _, isMember := strings.Cut(change.Before.Name, "."); isMember {
+				if _, ownerKept := after.Symbols[owner]; !ownerKept {
+					continue
+				}
+			}
+			removed = append(removed, qualifiedName(dir, change.Before.Name))
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+func plural(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// releaseNotes is the changelog section for the release, used as the tag
+// message
+func releaseNotes(suggestion releaseSuggestion) string {
+	notes := renderChangelog(suggestion.Next.String(), time.Now().Format(time.DateOnly), suggestion.Entries)
+	_, body, _ := strings.Cut(notes, "\n")
+	if len(suggestion.RemovedSymbols) > 0 {
+		body += "\n### Removed API\n\n"
+		for _, symbol := range suggestion.RemovedSymbols {
+			body += "- " + symbol + "\n"
+		}
+	}
+	return fmt.Sprintf("Release %s\n%s", suggestion.Next, body)
+}
+
+func newReleaseCmd(cdb *CommitDB) *cobra.Command {
+	cmdRelease := &cobra.Command{
+		Use:   "release",
+		Short: "Help cut releases",
+	}
+
+	var from string
+	var createTag bool
+	cmdSuggest := &cobra.Command{
+		Use:   "suggest",
+		Short: "Recommend the next semantic version since the last tag",
+		Long: "Classifies the commits since the last tag and looks for breaking changes in commit footers and removed exported Go symbols, " +
+			"then recommends the next version. With --tag it creates the annotated tag with release notes.",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				suggestion, err := suggestRelease(cmd.Context(), cdb, from)
+				if err != nil {
+					return err
+				}
+				current := suggestion.From
+				if current == "" {
+					current = "none"
+				}
+				fmt.Printf("Current version: %s\n", current)
+				fmt.Printf("Suggested:       %s (%s)\n\nWhy:\n", suggestion.Next, suggestion.Bump)
+				for _, reason := range suggestion.Reasons {
+					fmt.Printf("- %s\n", reason)
+				}
+				if !createTag {
+					return nil
+				}
+				if _, err := runGitRaw(releaseNotes(suggestion), "tag", "--annotate", "--cleanup=verbatim", "--file=-", suggestion.Next.String()); err != nil {
+					return err
+				}
+				fmt.Printf("\nCreated tag %s\n", suggestion.Next)
+				return nil
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+	cmdSuggest.Flags().StringVar(&from, "from", "", "tag to compare against, defaults to the newest semver tag")
+	cmdSuggest.Flags().BoolVar(&createTag, "tag", false, "create an annotated tag with generated release notes")
+	cmdRelease.AddCommand(cmdSuggest)
+	return cmdRelease
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const (
+	defaultRequestTimeout = 60 * time.Second
+	defaultMaxRetries     = 3
+	retryBaseDelay        = 1 * time.Second
+	retryMaxDelay         = 30 * time.Second
+	// retryAfterMaxDelay caps what a server may ask us to wait, so a bad
+	// Retry-After can't hang the program
+	retryAfterMaxDelay = 2 * time.Minute
+)
+
+// RequestLimits controls how long a single provider call may take and how
+// often a transient failure is retried.
+type RequestLimits struct {
+	Timeout    time.Duration
+	MaxRetries int
+}
+
+// requestLimitsFromSettings falls back to the defaults for anything the user
+// hasn't configured.
+func requestLimitsFromSettings(userSettings dbmodel.UserSettings) RequestLimits {
+	limits := RequestLimits{
+		Timeout:    defaultRequestTimeout,
+		MaxRetries: defaultMaxRetries,
+	}
+	if userSettings.RequestTimeoutSeconds != nil && *userSettings.RequestTimeoutSeconds > 0 {
+		limits.Timeout = time.Duration(*userSettings.RequestTimeoutSeconds) * time.Second
+	}
+	if userSettings.MaxRetries != nil && *userSettings.MaxRetries >= 0 {
+		limits.MaxRetries = int(*userSettings.MaxRetries)
+	}
+	return limits
+}
+
+// RetryStatus describes a retry that is about to happen.
+type RetryStatus struct {
+	Attempt    int // the attempt that failed, starting at 1
+	MaxRetries int
+	Delay      time.Duration
+	Reason     string
+}
+
+func (s RetryStatus) String() string {
+	return fmt.Sprintf("%s, retrying in %s (%d/%d)", s.Reason, s.Delay.Round(time.Second), s.Attempt, s.MaxRetries)
+}
+
+// retryingDoer is handed to the provider client as its HTTP client. It gives
+// every attempt its own timeout and retries rate limits, server errors and
+// network failures with exponential backoff, honouring Retry-After.
+type retryingDoer struct {
+	client  *http.Client
+	limits  RequestLimits
+	onRetry func(RetryStatus)
+}
+
+func newRetryingDoer(limits RequestLimits, onRetry func(RetryStatus)) *retryingDoer {
+	return &retryingDoer{
+		client:  &http.Client{},
+		limits:  limits,
+		onRetry: onRetry,
+	}
+}
+
+func (d *retryingDoer) Do(req *http.Request) (*http.Response, error) {
+	parent := req.Context()
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(parent)
+			attemptReq.Body = body
+		}
+
+		ctx, cancel := context.WithTimeout(parent, d.limits.Timeout)
+		resp, err := d.client.Do(attemptReq.WithContext(ctx))
+
+		reason, retryable := retryReason(resp, err)
+		if !retryable || attempt > d.limits.MaxRetries || parent.Err() != nil {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// The body is streamed after we return, so the attempt's
+			// timeout has to live until the caller closes it.
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		delay := backoffDelay(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = min(retryAfter, retryAfterMaxDelay)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		if d.onRetry != nil {
+			d.onRetry(RetryStatus{Attempt: attempt, MaxRetries: d.limits.MaxRetries, Delay: delay, Reason: reason})
+		}
+		select {
+		case <-time.After(delay):
+		case <-parent.Done():
+			return nil, parent.Err()
+		}
+	}
+}
+
+// retryReason reports whether a response or transport error is worth another
+// attempt, and why.
+func retryReason(resp *http.Response, err error) (string, bool) {
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "request timed out", true
+		}
+		if errors.Is(err, context.Canceled) {
+			return "", false
+		}
+		return "network error", true
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return "rate limited", true
+	case resp.StatusCode >= 500:
+		return fmt.Sprintf("provider returned %d", resp.StatusCode), true
+	}
+	return "", false
+}
+
+// backoffDelay doubles the wait for every failed attempt, with up to 50%
+// jitter so parallel clients don't retry in lockstep.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter understands both forms of the header: a number of seconds
+// or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/phuslu/log"
+	"github.com/spf13/cobra"
+)
+
+const reviewPrompt = `You review staged changes before they are committed, like a careful colleague would.
+You get the diff of each file. Every line of a hunk starts with its line number in the new version of the file; removed lines have no number.
+Only comment on the changed lines and on what they break elsewhere in the shown code. Skip praise, and skip nitpicks a formatter or linter would catch.
+Each finding has:
+- file: the path as shown in the diff
+- line: the line number in the new file the finding is about
+- severity: "error" for bugs and security problems, "warning" for likely problems, "info" for suggestions
+- category: one of ` + "bug, security, performance, error-handling, concurrency, maintainability, style, tests, docs" + `
+- message: what is wrong, in one or two sentences
+- suggestion: how to fix it, in one or two sentences
+Answer with JSON only, in this form:
+{"findings": [{"file": "main.go", "line": 42, "severity": "warning", "category": "bug", "message": "...", "suggestion": "..."}]}
+Answer with an empty list when there is nothing worth pointing out.`
+
+// reviewSeverities are the severities findings can have, most severe first
+var reviewSeverities = []string{"error", "warning", "info"}
+
+var reviewCategories = []string{"bug", "security", "performance", "error-handling", "concurrency", "maintainability", "style", "tests", "docs"}
+
+// maxReviewBatchLines keeps each review request small enough for the
+// model to look at every line. Files are never split across requests.
+const maxReviewBatchLines = 1200
+
+// reviewFinding is one problem the model found in the staged changes
+type reviewFinding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Severity   string `json:"severity"`
+	Category   string `json:"category"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion"`
+}
+
+// numberedHunk renders a hunk with the new file's line numbers in front,
+// so the model and the TUI can point at lines
+func numberedHunk(hunk Hunk) []string {
+	lines := []string{hunk.renderHeader(hunk.NewStart)}
+	line := hunk.NewStart
+	for _, text := range hunk.Lines {
+		if strings.HasPrefix(text, "-") || strings.HasPrefix(text, `\`) {
+			lines = append(lines, fmt.Sprintf("%6s %s", "", text))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%6d %s", line, text))
+		line++
+	}
+	return lines
+}
+
+func describeReviewFile(f FileDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s (%s)\n", f.Path(), f.Status)
+	for _, hunk := range f.Hunks {
+		b.WriteString(strings.Join(numberedHunk(hunk), "\n") + "\n")
+	}
+	return b.String()
+}
+
+// reviewBatches groups the files to review into requests. Lockfiles,
+// generated and binary files are left out; there is nothing to review.
+func reviewBatches(files []FileDiff) [][]FileDiff {
+	var batches [][]FileDiff
+	var batch []FileDiff
+	lines := 0
+	for _, f := range files {
+		if ClassifyFile(f) != KindSource || f.Status == FileDeleted || len(f.Hunks) == 0 {
+			continue
+		}
+		size := 0
+		for _, hunk := range f.Hunks {
+			size += len(hunk.Lines)
+		}
+		if len(batch) > 0 && lines+size > maxReviewBatchLines {
+			batches = append(batches, batch)
+			batch, lines = nil, 0
+		}
+		batch = append(batch, f)
+		lines += size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// normalizeFindings drops findings about files that weren't asked about and
+// maps unknown severities and categories to the closest thing we have
+func normalizeFindings(findings []reviewFinding, files []FileDiff) []reviewFinding {
+	var normalized []reviewFinding
+	for _, finding := range findings {
+		known := false
+		for _, f := range files {
+			if f.Path() == finding.File {
+				known = true
+			}
+		}
+		if !known || strings.TrimSpace(finding.Message) == "" {
+			continue
+		}
+		finding.Severity = strings.ToLower(strings.TrimSpace(finding.Severity))
+		if !StringInSlice(finding.Severity, reviewSeverities) {
+			finding.Severity = "warning"
+		}
+		finding.Category = strings.ToLower(strings.TrimSpace(finding.Category))
+		if !StringInSlice(finding.Category, reviewCategories) {
+			finding.Category = "maintainability"
+		}
+		if finding.Line < 1 {
+			finding.Line = 1
+		}
+		finding.Message = strings.TrimSpace(finding.Message)
+		finding.Suggestion = strings.TrimSpace(finding.Suggestion)
+		normalized = append(normalized, finding)
+	}
+	return normalized
+}
+
+func severityRank(severity string) int {
+	for i, s := range reviewSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(reviewSeverities)
+}
+
+// reviewStaged asks the model to review the staged files, one batch at a
+// time. Findings are sorted by severity, then by position.
+func reviewStaged(ctx context.Context, client *llmClient, files []FileDiff, progress func(status string)) ([]reviewFinding, error) {
+	batches := reviewBatches(files)
+	findings := []reviewFinding{}
+	for i, batch := range batches {
+		if len(batches) > 1 {
+			progress(fmt.Sprintf("Reviewing part %d of %d", i+1, len(batches)))
+		} else {
+			progress(fmt.Sprintf("Reviewing %d files", len(batch)))
+		}
+		var human strings.Builder
+		for _, f := range batch {
+			human.WriteString(describeReviewFile(f) + "\n")
+		}
+		answer, err := client.Complete(ctx, reviewPrompt, human.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := extractJSON(answer)
+		if err != nil {
+			return nil, err
+		}
+		var parsed struct {
+			Findings []reviewFinding `json:"findings"`
+		}
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			return nil, fmt.Errorf("could not read the review: %w", err)
+		}
+		findings = append(findings, normalizeFindings(parsed.Findings, batch)...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if severityRank(a.Severity) != severityRank(b.Severity) {
+			return severityRank(a.Severity) < severityRank(b.Severity)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return findings, nil
+}
+
+// findingHunk is the hunk a finding points into, or the closest one when
+// the line is outside every hunk
+func findingHunk(files []FileDiff, finding reviewFinding) (Hunk, bool) {
+	for _, f := range files {
+		if f.Path() != finding.File || len(f.Hunks) == 0 {
+			continue
+		}
+		best, distance := f.Hunks[0], -1
+		for _, hunk := range f.Hunks {
+			d := 0
+			if finding.Line < hunk.NewStart {
+				d = hunk.NewStart - finding.Line
+			} else if end := hunk.NewStart + hunk.NewLines - 1; finding.Line > end {
+				d = finding.Line - end
+			}
+			if distance < 0 || d < distance {
+				best, distance = hunk, d
+			}
+		}
+		return best, true
+	}
+	return Hunk{}, false
+}
+
+// ---------------- Output ----------------
+
+func renderFindingsText(findings []reviewFinding) string {
+	if len(findings) == 0 {
+		return "No findings.\n"
+	}
+	var b strings.Builder
+	for _, finding := range findings {
+		fmt.Fprintf(&b, "%s:%d: %s [%s] %s\n", finding.File, finding.Line, finding.Severity, finding.Category, finding.Message)
+		if finding.Suggestion != "" {
+			fmt.Fprintf(&b, "    suggestion: %s\n", finding.Suggestion)
+		}
+	}
+	return b.String()
+}
+
+func renderFindingsJSON(findings []reviewFinding) (string, error) {
+	out, err := json.MarshalIndent(struct {
+		Findings []reviewFinding `json:"findings"`
+	}{findings}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine int `json:"startLine"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+// renderFindingsSARIF writes the findings as a SARIF 2.1.0 log, with one
+// rule per category, for code scanning tools
+func renderFindingsSARIF(findings []reviewFinding, model string) (string, error) {
+	var rules []sarifRule
+	for _, category := range reviewCategories {
+		rules = append(rules, sarifRule{ID: category, ShortDescription: sarifMessage{Text: "AI review: " + category}})
+	}
+	results := []sarifResult{}
+	for _, finding := range findings {
+		// SARIF calls informational results notes
+		level := finding.Severity
+		if level == "info" {
+			level = "note"
+		}
+		text := finding.Message
+		if finding.Suggestion != "" {
+			text += "\n\nSuggestion: " + finding.Suggestion
+		}
+		var location sarifLocation
+		location.PhysicalLocation.ArtifactLocation.URI = finding.File
+		location.PhysicalLocation.Region.StartLine = finding.Line
+		results = append(results, sarifResult{
+			RuleID:    finding.Category,
+			Level:     level,
+			Message:   sarifMessage{Text: text},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	type sarifDriver struct {
+		Name     string      `json:"name"`
+		FullName string      `json:"fullName,omitempty"`
+		Rules    []sarifRule `json:"rules"`
+	}
+	type sarifRun struct {
+		Tool struct {
+			Driver sarifDriver `json:"driver"`
+		} `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	run := sarifRun{Results: results}
+	run.Tool.Driver = sarifDriver{Name: "aicommit", Rules: rules}
+	if model != "" {
+		run.Tool.Driver.FullName = "aicommit review (" + model + ")"
+	}
+	out, err := json.MarshalIndent(struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}{"https://json.schemastore.org/sarif-2.1.0.json", "2.1.0", []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+// ---------------- TUI ----------------
+
+var (
+	reviewSeverityStyles = map[string]lipgloss.Style{
+		"error":   lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5F87")),
+		"warning": lipgloss.NewStyle().Foreground(lipgloss.Color("#FFAF00")),
+		"info":    lipgloss.NewStyle().Foreground(lipgloss.Color("#5FAFFF")),
+	}
+	reviewLineStyle = lipgloss.NewStyle().Reverse(true)
+)
+
+// reviewContextLines is how much of the hunk is shown around the finding
+const reviewContextLines = 12
+
+type reviewDoneMsg struct {
+	findings []reviewFinding
+}
+
+type reviewModel struct {
+	client   *llmClient
+	files    []FileDiff
+	findings []reviewFinding
+	cursor   int
+	loading  bool
+	status   string
+	spinner  spinner.Model
+	progress chan string
+	err      *AppError
+	ctx      context.Context
+	cancel   context.CancelFunc
+	width    int
+}
+
+func newReviewModel(client *llmClient, files []FileDiff) reviewModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	return reviewModel{
+		client:   client,
+		files:    files,
+		loading:  true,
+		status:   "Reviewing",
+		spinner:  spinner.New(),
+		progress: make(chan string),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (m reviewModel) Init() tea.Cmd {
+	ctx, client, files, progress := m.ctx, m.client, m.files, m.progress
+	report := func(status string) {
+		select {
+		case progress <- status:
+		case <-ctx.Done():
+		}
+	}
+	client.onRetry = func(status RetryStatus) {
+		report(status.String())
+	}
+	return tea.Batch(m.spinner.Tick, waitForActivity(progress), func() tea.Msg {
+		findings, err := reviewStaged(ctx, client, files, report)
+		if err != nil {
+			return errMsg{err}
+		}
+		return reviewDoneMsg{findings}
+	})
+}
+
+func (m reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancel()
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.findings)-1 {
+				m.cursor++
+			}
+		}
+	case spinner.TickMsg:
+		if m.loading {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+	case responseMsg:
+		m.status = msg.messageContent
+		return m, waitForActivity(m.progress)
+	case reviewDoneMsg:
+		m.loading = false
+		m.findings = msg.findings
+	case errMsg:
+		m.loading = false
+		m.err = asAppError(msg.err)
+	}
+	return m, nil
+}
+
+// hunkView shows the part of the hunk around the finding's line
+func (m reviewModel) hunkView(finding reviewFinding) string {
+	hunk, ok := findingHunk(m.files, finding)
+	if !ok {
+		return helpStyle.Render("The file is not part of the diff.")
+	}
+	lines := numberedHunk(hunk)
+	target := 0
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(line[:6]) == fmt.Sprint(finding.Line) {
+			target = i + 1
+		}
+	}
+	start := max(1, target-reviewContextLines)
+	end := min(len(lines), max(target, 1)+reviewContextLines+1)
+	var b strings.Builder
+	b.WriteString(helpStyle.Render(lines[0]) + "\n")
+	for i := start; i < end; i++ {
+		if i == target {
+			b.WriteString(reviewLineStyle.Render(lines[i]) + "\n")
+		} else {
+			b.WriteString(lines[i] + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (m reviewModel) View() string {
+	if m.err != nil {
+		return renderError(m.err, []string{"q quit"}, m.width)
+	}
+	var b strings.Builder
+	b.WriteString("\n")
+	if m.loading {
+		fmt.Fprintf(&b, " %s %s...\n", m.spinner.View(), m.status)
+		return mainContentStyle.Width(m.width).Render(b.String())
+	}
+	if len(m.findings) == 0 {
+		b.WriteString(" No findings, the staged changes look fine.\n")
+		b.WriteString("\n " + helpStyle.Render("q quit") + "\n")
+		return mainContentStyle.Width(m.width).Render(b.String())
+	}
+
+	listWidth := max(m.width/3, 30)
+	var list strings.Builder
+	for i, finding := range m.findings {
+		pointer := "  "
+		if i == m.cursor {
+			pointer = "> "
+		}
+		label := fmt.Sprintf("%s:%d", finding.File, finding.Line)
+		if len(label) > listWidth-14 {
+			label = "…" + label[len(label)-(listWidth-15):]
+		}
+		severity := reviewSeverityStyles[finding.Severity].Render(fmt.Sprintf("%-7s", finding.Severity))
+		fmt.Fprintf(&list, "%s%s %s\n", pointer, severity, label)
+	}
+
+	finding := m.findings[m.cursor]
+	detailWidth := max(m.width-listWidth-6, 30)
+	var detail strings.Builder
+	fmt.Fprintf(&detail, "%s %s\n\n", reviewSeverityStyles[finding.Severity].Render(finding.Severity), helpStyle.Render(finding.Category))
+	detail.WriteString(wrapText(finding.Message, detailWidth-4) + "\n")
+	if finding.Suggestion != "" {
+		detail.WriteString("\n" + wrapText("Suggestion: "+finding.Suggestion, detailWidth-4) + "\n")
+	}
+	detail.WriteString("\n" + m.hunkView(finding))
+
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top,
+		" ", lipgloss.NewStyle().Width(listWidth).Render(list.String()),
+		" ", rewordBoxStyle.Width(detailWidth).Render(detail.String())) + "\n")
+	fmt.Fprintf(&b, "\n %s\n", helpStyle.Render(fmt.Sprintf("%d of %d • ↑/↓ select • q quit", m.cursor+1, len(m.findings))))
+	return mainContentStyle.Width(m.width).Render(b.String())
+}
+
+// ---------------- CLI ----------------
+
+func newReviewCmd(cdb *CommitDB) *cobra.Command {
+	var format string
+	var outputFile string
+	cmdReview := &cobra.Command{
+		Use:   "review",
+		Short: "Review the staged changes with AI before committing",
+		Long: "Sends the staged diff to the model and lists what it finds, with file, line, severity, category and a suggestion. " +
+			"On a terminal the findings are shown next to their hunk; --format json or sarif writes them for other tools instead.",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "" && format != "text" && format != "json" && format != "sarif" {
+				err := fmt.Errorf("--format must be text, json or sarif, not %q", format)
+				showFatalError(err)
+				return err
+			}
+			diff, _, err := getStagedDiff(0)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			files := ParseGitDiff(diff)
+			client, err := loadLLMClient(cdb)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+
+			if format == "" && outputFile == "" && log.IsTerminal(os.Stdout.Fd()) {
+				finalModel, err := tea.NewProgram(newReviewModel(client, files)).Run()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, "could not start program:", err)
+					return err
+				}
+				if m, ok := finalModel.(reviewModel); ok && m.err != nil {
+					return m.err
+				}
+				return nil
+			}
+
+			err = func() error {
+				client.onRetry = func(status RetryStatus) {
+					fmt.Fprintln(os.Stderr, status.String())
+				}
+				findings, err := reviewStaged(cmd.Context(), client, files, func(status string) { fmt.Fprintln(os.Stderr, status) })
+				if err != nil {
+					return err
+				}
+				var output string
+				switch format {
+				case "json":
+					output, err = renderFindingsJSON(findings)
+				case "sarif":
+					output, err = renderFindingsSARIF(findings, client.model)
+				default:
+					output = renderFindingsText(findings)
+				}
+				if err != nil {
+					return err
+				}
+				if outputFile != "" {
+					return os.WriteFile(outputFile, []byte(output), 0o644)
+				}
+				fmt.Print(output)
+				return nil
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+	cmdReview.Flags().StringVar(&format, "format", "", "write the findings as text, json or sarif instead of showing them in the TUI")
+	cmdReview.Flags().StringVarP(&outputFile, "output", "o", "", "write the findings to this file")
+	return cmdReview
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+)
+
+const rewordHintPrompt = "\nThe commit's current message is given after the diff. Use it as a hint about intent, but describe what the diff actually does.\n"
+
+// rewordBackupPrefix is where the branch is saved before it is rewritten
+const rewordBackupPrefix = "refs/aicommit/backup/"
+
+var rewordBoxStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+
+type rewordCommit struct {
+	SHA         string
+	Tree        string
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  string
+	OldMessage  string
+	NewMessage  string
+	UseNew      bool
+}
+
+// rewordRange resolves the commits to reword. A single revision means
+// everything after it up to HEAD. Merges and commits already on any
+// remote branch can't be rewritten.
+func rewordRange(arg string) ([]rewordCommit, error) {
+	if strings.Contains(arg, "...") {
+		return nil, fmt.Errorf("%s is a symmetric difference, give a range like base..HEAD instead", arg)
+	}
+	base, end, isRange := strings.Cut(arg, "..")
+	if !isRange {
+		base, end = arg, "HEAD"
+	}
+	if end == "" {
+		end = "HEAD"
+	}
+	endSHA, err := runGit("rev-parse", "--verify", end+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	headSHA, err := runGit("rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if endSHA != headSHA {
+		return nil, fmt.Errorf("the range has to end at HEAD, %s is not HEAD", end)
+	}
+	revRange := base + ".." + headSHA
+
+	if merges, err := runGit("rev-list", "--merges", revRange); err != nil {
+		return nil, err
+	} else if merges != "" {
+		return nil, errors.New("the range contains merge commits, which can't be reworded")
+	}
+
+	out, err := runGit("log", "--reverse", "--format=%H%x1f%T%x1f%an%x1f%ae%x1f%ad%x1f%B%x1e", "--date=raw", revRange)
+	if err != nil {
+		return nil, err
+	}
+	var commits []rewordCommit
+	for _, record := range strings.Split(out, "\x1e") {
+		fields := strings.Split(strings.TrimLeft(record, "\n"), "\x1f")
+		if len(fields) < 6 {
+			continue
+		}
+		commits = append(commits, rewordCommit{
+			SHA:         fields[0],
+			Tree:        fields[1],
+			AuthorName:  fields[2],
+			AuthorEmail: fields[3],
+			AuthorDate:  fields[4],
+			OldMessage:  strings.TrimSpace(fields[5]),
+			UseNew:      true,
+		})
+	}
+	if len(commits) == 0 {
+		return nil, newAppError(ErrNoChanges, fmt.Errorf("no commits in %s", revRange))
+	}
+
+	// Checking against every remote ref, not just the upstream, also covers
+	// branches without one and commits pushed to another branch
+	unpushed, err := runGit("rev-list", revRange, "--not", "--remotes")
+	if err != nil {
+		return nil, err
+	}
+	for _, commit := range commits {
+		if !strings.Contains(unpushed, commit.SHA) {
+			return nil, fmt.Errorf("commit %s is already on a remote branch, refusing to rewrite published history", shortSHA(commit.SHA))
+		}
+	}
+	return commits, nil
+}
+
+// commitDiff is the patch a single commit introduces
+func commitDiff(sha string) (string, error) {
+	return runGitRaw("", "diff-tree", "-p", "-U10", "--no-commit-id", "--root", sha)
+}
+
+func generateRewordMessage(ctx context.Context, client *llmClient, repoConfig RepoConfig, scopes repoScopes, ticket string, lang language, commit rewordCommit) (string, error) {
+	diff, err := commitDiff(commit.SHA)
+	if err != nil {
+		return "", err
+	}
+	files := ParseGitDiff(diff)
+	change := scopes.forFiles(files)
+	repoConfig.Lint.Scopes = change.Allowed
+	prompt := CondenseDiff(files).String() + "\nCurrent message:\n" + commit.OldMessage
+	message, err := completeInLanguage(ctx, client, lang, commitMessageSystemPrompt(repoConfig, ticket, lang)+change.prompt()+rewordHintPrompt, prompt, nil)
+	if err != nil {
+		return "", err
+	}
+	message, err = finishMessage(message, repoConfig, ticket, nil)
+	if err != nil {
+		return "", err
+	}
+	message = change.constrain(message)
+	// Trailers like co-authors and sign-offs are facts about the commit the
+	// model can't know, so the old ones are kept
+	var trailers []string
+	for _, t := range parseTrailers(commit.OldMessage) {
+		trailers = append(trailers, t.Key+": "+t.Value)
+	}
+	return appendTrailers(message, trailers)
+}
+
+// rewriteCommits recreates the commits on top of the first one's parent
+// with the chosen messages, keeping trees and authors, then moves the
+// branch. Since the final tree is unchanged the index and working tree
+// stay as they are. The old tip is kept under a backup ref.
+func rewriteCommits(commits []rewordCommit) (string, string, error) {
+	oldHead := commits[len(commits)-1].SHA
+	parent, err := runGit("rev-parse", "--verify", "--quiet", commits[0].SHA+"^")
+	if err != nil {
+		// Rewording from the root commit
+		parent = ""
+	}
+
+	headRef, err := runGit("symbolic-ref", "--quiet", "HEAD")
+	if err != nil {
+		headRef = ""
+	}
+	backupName := "HEAD"
+	if headRef != "" {
+		backupName = strings.TrimPrefix(headRef, "refs/heads/")
+	}
+	backupRef := fmt.Sprintf("%s%s/%s", rewordBackupPrefix, backupName, time.Now().Format("20060102-150405"))
+	if _, err := runGit("update-ref", backupRef, oldHead); err != nil {
+		return "", "", err
+	}
+
+	for _, commit := range commits {
+		message := commit.OldMessage
+		if commit.UseNew {
+			message = commit.NewMessage
+		}
+		args := []string{"commit-tree", commit.Tree, "-F", "-"}
+		if parent != "" {
+			args = append(args, "-p", parent)
+		}
+		env := []string{
+			"GIT_AUTHOR_NAME=" + commit.AuthorName,
+			"GIT_AUTHOR_EMAIL=" + commit.AuthorEmail,
+			"GIT_AUTHOR_DATE=" + commit.AuthorDate,
+		}
+		out, err := runGitEnv(env, message+"\n", args...)
+		if err != nil {
+			return "", backupRef, err
+		}
+		parent = strings.TrimSpace(out)
+	}
+
+	updateArgs := []string{"update-ref", "-m", "aicommit reword", "HEAD", parent, oldHead}
+	if headRef == "" {
+		updateArgs = append([]string{"update-ref", "--no-deref"}, updateArgs[1:]...)
+	}
+	if _, err := runGit(updateArgs...); err != nil {
+		return "", backupRef, err
+	}
+	return parent, backupRef, nil
+}
+
+// ---------------- TUI ----------------
+
+type rewordState int
+
+const (
+	rewordGenerating rewordState = iota
+	rewordReviewing
+	rewordDone
+	rewordFailed
+)
+
+type rewordMessageMsg struct {
+	index   int
+	message string
+}
+
+type rewordDoneMsg struct {
+	head      string
+	backupRef string
+}
+
+type rewordModel struct {
+	state      rewordState
+	client     *llmClient
+	repoConfig RepoConfig
+	scopes     repoScopes
+	ticket     string
+	lang       language
+	commits    []rewordCommit
+	pending    int // messages still being generated
+	cursor     int
+	spinner    spinner.Model
+	head       string
+	backupRef  string
+	err        *AppError
+	cancel     context.CancelFunc
+	ctx        context.Context
+	width      int
+}
+
+func newRewordModel(client *llmClient, repoConfig RepoConfig, scopes repoScopes, ticket string, lang language, commits []rewordCommit) rewordModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	return rewordModel{
+		state:      rewordGenerating,
+		client:     client,
+		repoConfig: repoConfig,
+		scopes:     scopes,
+		ticket:     ticket,
+		lang:       lang,
+		commits:    commits,
+		pending:    len(commits),
+		spinner:    spinner.New(),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (m rewordModel) generate(index int) tea.Cmd {
+	ctx, client, repoConfig, scopes, ticket, lang, commit := m.ctx, m.client, m.repoConfig, m.scopes, m.ticket, m.lang, m.commits[index]
+	return func() tea.Msg {
+		message, err := generateRewordMessage(ctx, client, repoConfig, scopes, ticket, lang, commit)
+		if err != nil {
+			return errMsg{err}
+		}
+		return rewordMessageMsg{index: index, message: message}
+	}
+}
+
+func (m rewordModel) Init() tea.Cmd {
+	// One at a time, so rate limits are hit less often
+	return tea.Batch(m.spinner.Tick, m.generate(0))
+}
+
+func (m rewordModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		return m, nil
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		if m.pending > 0 {
+			m.spinner, cmd = m.spinner.Update(msg)
+		}
+		return m, cmd
+	case rewordMessageMsg:
+		m.commits[msg.index].NewMessage = msg.message
+		m.pending--
+		if m.state == rewordGenerating && msg.index+1 < len(m.commits) {
+			return m, m.generate(msg.index + 1)
+		}
+		m.state = rewordReviewing
+		return m, nil
+	case rewordDoneMsg:
+		m.head = msg.head
+		m.backupRef = msg.backupRef
+		m.state = rewordDone
+		return m, nil
+	case errMsg:
+		m.err = asAppError(msg.err)
+		m.state = rewordFailed
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "q", "esc":
+			m.cancel()
+			return m, tea.Quit
+		}
+		if m.state != rewordReviewing {
+			return m, nil
+		}
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.commits)-1 {
+				m.cursor++
+			}
+		case " ", "x":
+			m.commits[m.cursor].UseNew = !m.commits[m.cursor].UseNew
+		case "r":
+			if m.pending == 0 {
+				m.pending++
+				return m, tea.Batch(m.generate(m.cursor), m.spinner.Tick)
+			}
+		case "enter":
+			if m.pending > 0 {
+				return m, nil
+			}
+			commits := m.commits
+			return m, func() tea.Msg {
+				head, backupRef, err := rewriteCommits(commits)
+				if err != nil {
+					if backupRef != "" {
+						err = fmt.Errorf("%w (the original commits are kept in %s)", err, backupRef)
+					}
+					return errMsg{err}
+				}
+				return rewordDoneMsg{head: head, backupRef: backupRef}
+			}
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m rewordModel) View() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	switch m.state {
+	case rewordGenerating:
+		fmt.Fprintf(&b, " %s Writing message %d/%d...\n", m.spinner.View(), len(m.commits)-m.pending+1, len(m.commits))
+	case rewordFailed:
+		return renderError(m.err, []string{"q quit"}, m.width)
+	case rewordDone:
+		fmt.Fprintf(&b, " Reworded %d commits, HEAD is now %s.\n", len(m.commits), shortSHA(m.head))
+		fmt.Fprintf(&b, " The old commits are kept in %s.\n", m.backupRef)
+		fmt.Fprintf(&b, " To undo: git reset --keep %s\n", m.backupRef)
+		b.WriteString("\n " + helpStyle.Render("q quit") + "\n")
+	case rewordReviewing:
+		for i, commit := range m.commits {
+			pointer := "  "
+			if i == m.cursor {
+				pointer = "> "
+			}
+			box := "[ ]"
+			if commit.UseNew {
+				box = "[x]"
+			}
+			fmt.Fprintf(&b, " %s%s %s %s → %s\n", pointer, box, shortSHA(commit.SHA), firstLine(commit.OldMessage), firstLine(commit.NewMessage))
+		}
+		b.WriteString("\n")
+
+		commit := m.commits[m.cursor]
+		width := max((m.width-4)/2, 20)
+		old := rewordBoxStyle.Width(width).Render("Current\n\n" + commit.OldMessage)
+		generated := rewordBoxStyle.Width(width).Render("Generated\n\n" + commit.NewMessage)
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, " ", old, " ", generated) + "\n")
+		if m.pending > 0 {
+			fmt.Fprintf(&b, "\n %s Regenerating...\n", m.spinner.View())
+		}
+		b.WriteString("\n " + helpStyle.Render("↑/↓ select • space keep current/use generated • r regenerate • enter rewrite • q abort") + "\n")
+	}
+	return mainContentStyle.Width(m.width).Render(b.String())
+}
+
+// ---------------- CLI ----------------
+
+func newRewordCmd(cdb *CommitDB) *cobra.Command {
+	return &cobra.Command{
+		Use:   "reword <range>",
+		Short: "Replace the messages of existing commits with generated ones",
+		Long: "Generates a message for each commit in the range from its own diff and lets you pick which to use before rewriting the branch. " +
+			"A single revision means everything after it up to HEAD. Commits that are already on a remote branch are never rewritten, " +
+			"and the old branch tip is kept under " + rewordBackupPrefix + ".",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			commits, err := rewordRange(args[0])
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			client, err := loadLLMClient(cdb)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			repoConfig, err := loadRepoConfig()
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+
+			overrides := messageOverridesFromFlags(cmd)
+			repoConfig = overrides.apply(repoConfig)
+			ticket := currentTicket(repoConfig.Ticket, overrides.Ticket)
+			lang := messageLanguage(repoConfig, client.language, overrides.Language)
+			scopes, err := loadRepoScopes(repoConfig)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			finalModel, err := tea.NewProgram(newRewordModel(client, repoConfig, scopes, ticket, lang, commits)).Run()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not start program:", err)
+				return err
+			}
+			if m, ok := finalModel.(rewordModel); ok && m.err != nil {
+				return m.err
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ScopeConfig maps paths to Conventional Commits scopes, for repositories
+// with several packages. Rules are tried in order and the first match wins.
+// Discover adds a rule per go.work module, package.json workspace or
+// top-level directory; Learn uses the scopes earlier commits used for the
+// same directories. Both are off unless the config turns them on. Strict
+// makes the linter reject other scopes.
+type ScopeConfig struct {
+	Rules    []ScopeRule `json:"rules"`
+	Discover bool        `json:"discover"`
+	Learn    bool        `json:"learn"`
+	Strict   bool        `json:"strict"`
+}
+
+// ScopeRule gives every file matching the glob a scope. ** matches any
+// number of directories.
+type ScopeRule struct {
+	Path  string `json:"path"`
+	Scope string `json:"scope"`
+}
+
+// scopeHistoryCommits is how far back scopes are learned from
+const scopeHistoryCommits = 300
+
+// minLearnedScopeCommits is how often a scope must have been used before it
+// is offered
+const minLearnedScopeCommits = 2
+
+var scopeNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// globRegex turns a path glob into a regular expression. * and ? stay
+// within a directory, ** crosses directories, and a pattern for a
+// directory matches everything below it.
+func globRegex(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimSuffix(strings.TrimPrefix(glob, "./"), "/")
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+func validateScopeRules(rules []ScopeRule) error {
+	for _, rule := range rules {
+		if _, err := globRegex(rule.Path); err != nil || rule.Path == "" {
+			return fmt.Errorf("scope rule path %q is not a valid glob", rule.Path)
+		}
+		if !scopeNameRegex.MatchString(rule.Scope) {
+			return fmt.Errorf("scope %q for %s is not a valid scope name", rule.Scope, rule.Path)
+		}
+	}
+	return nil
+}
+
+// ---------------- Discovery ----------------
+
+var goWorkUseRegex = regexp.MustCompile(`(?m)^\s*use\s+(?:\(([^)]*)\)|(\S+))`)
+
+// goWorkModules reads the module directories from a go.work file
+func goWorkModules(content string) []string {
+	var dirs []string
+	for _, match := range goWorkUseRegex.FindAllStringSubmatch(content, -1) {
+		for _, line := range strings.Split(match[1]+"\n"+match[2], "\n") {
+			line, _, _ = strings.Cut(line, "//")
+			if dir := strings.Trim(strings.TrimSpace(line), `"`); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// packageWorkspaces reads the workspace globs from a package.json, in
+// either the npm/yarn list form or yarn's {"packages": [...]} form
+func packageWorkspaces(content []byte) []string {
+	var manifest struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if json.Unmarshal(content, &manifest) != nil || manifest.Workspaces == nil {
+		return nil
+	}
+	var globs []string
+	if json.Unmarshal(manifest.Workspaces, &globs) == nil {
+		return globs
+	}
+	var nested struct {
+		Packages []string `json:"packages"`
+	}
+	json.Unmarshal(manifest.Workspaces, &nested)
+	return nested.Packages
+}
+
+// discoverScopes finds the packages of a monorepo: go.work modules, then
+// package.json workspaces, and otherwise the tracked top-level directories.
+// Each package's scope is its directory name.
+func discoverScopes(root string) []ScopeRule {
+	var dirs []string
+	if content, err := os.ReadFile(filepath.Join(root, "go.work")); err == nil {
+		dirs = append(dirs, goWorkModules(string(content))...)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		for _, glob := range packageWorkspaces(content) {
+			matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(glob)))
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.IsDir() {
+					rel, _ := filepath.Rel(root, match)
+					dirs = append(dirs, filepath.ToSlash(rel))
+				}
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		out, err := runGit("ls-tree", "-d", "--name-only", "--full-tree", "HEAD")
+		if err == nil && out != "" {
+			for _, dir := range strings.Split(out, "\n") {
+				if !strings.HasPrefix(dir, ".") {
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+	}
+
+	var rules []ScopeRule
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		dir = path.Clean(strings.TrimPrefix(filepath.ToSlash(dir), "./"))
+		scope := path.Base(dir)
+		if dir == "." || seen[dir] || !scopeNameRegex.MatchString(scope) {
+			continue
+		}
+		seen[dir] = true
+		rules = append(rules, ScopeRule{Path: dir, Scope: scope})
+	}
+	// Nested packages must win over the directories that contain them
+	sort.SliceStable(rules, func(i, j int) bool {
+		return strings.Count(rules[i].Path, "/") > strings.Count(rules[j].Path, "/")
+	})
+	return rules
+}
+
+// ---------------- Learning ----------------
+
+// scopeHistory is what the repository's history says about scopes: how
+// often each was used, and which scopes were used for changes below each
+// directory
+type scopeHistory struct {
+	Counts map[string]int
+	Dirs   map[string]map[string]int
+}
+
+// learnScopes reads the scopes of recent Conventional Commits together with
+// the files those commits changed
+func learnScopes() scopeHistory {
+	history := scopeHistory{Counts: map[string]int{}, Dirs: map[string]map[string]int{}}
+	out, err := runGit("log", fmt.Sprintf("--max-count=%d", scopeHistoryCommits), "--no-merges", "--format=%x1e%s", "--name-only", "HEAD")
+	if err != nil {
+		return history
+	}
+	for _, record := range strings.Split(out, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		header, ok := parseConventionalHeader(lines[0], "")
+		if !ok || header.Scope == "" {
+			continue
+		}
+		history.Counts[header.Scope]++
+		dirs := map[string]bool{}
+		for _, file := range lines[1:] {
+			for dir := path.Dir(strings.TrimSpace(file)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+				dirs[dir] = true
+			}
+		}
+		for dir := range dirs {
+			if history.Dirs[dir] == nil {
+				history.Dirs[dir] = map[string]int{}
+			}
+			history.Dirs[dir][header.Scope]++
+		}
+	}
+	return history
+}
+
+// dirScope is the scope most commits below the file's closest directory
+// used, if enough of them agree
+func (h scopeHistory) dirScope(file string) (string, bool) {
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		total, best := 0, ""
+		for scope, count := range h.Dirs[dir] {
+			total += count
+			if best == "" || count > h.Dirs[dir][best] || (count == h.Dirs[dir][best] && scope < best) {
+				best = scope
+			}
+		}
+		if best != "" && h.Dirs[dir][best] >= minLearnedScopeCommits && h.Dirs[dir][best]*2 > total {
+			return best, true
+		}
+	}
+	return "", false
+}
+
+// ---------------- Resolution ----------------
+
+// repoScopes is the scope setup of a repository, resolved once per run
+type repoScopes struct {
+	rules      []ScopeRule
+	regexes    []*regexp.Regexp
+	configured int // the rules before this are from the config, the rest were discovered
+	history    scopeHistory
+	allowed    []string
+}
+
+// loadRepoScopes resolves the configured, discovered and learned scopes.
+// It returns nothing when messages aren't Conventional Commits, which are
+// the only ones with scopes.
+func loadRepoScopes(config RepoConfig) (repoScopes, error) {
+	var scopes repoScopes
+	if !config.Lint.Conventional {
+		return scopes, nil
+	}
+	scopes.rules = append(scopes.rules, config.Scopes.Rules...)
+	scopes.configured = len(scopes.rules)
+	if config.Scopes.Discover {
+		root, err := runGit("rev-parse", "--show-toplevel")
+		if err != nil {
+			return scopes, err
+		}
+		scopes.rules = append(scopes.rules, discoverScopes(root)...)
+	}
+	for _, rule := range scopes.rules {
+		re, err := globRegex(rule.Path)
+		if err != nil {
+			return scopes, err
+		}
+		scopes.regexes = append(scopes.regexes, re)
+	}
+	if config.Scopes.Learn {
+		scopes.history = learnScopes()
+	}
+
+	counts := map[string]int{}
+	for _, rule := range scopes.rules {
+		counts[rule.Scope] = 0
+	}
+	for scope, count := range scopes.history.Counts {
+		if _, known := counts[scope]; known || count >= minLearnedScopeCommits {
+			counts[scope] += count
+		}
+	}
+	for scope := range counts {
+		scopes.allowed = append(scopes.allowed, scope)
+	}
+	// Scopes the team uses a lot come first, so they're the ones the model
+	// notices
+	sort.Slice(scopes.allowed, func(i, j int) bool {
+		a, b := scopes.allowed[i], scopes.allowed[j]
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+	return scopes, nil
+}
+
+// fileScope is the scope of one file: the first matching configured rule,
+// then what history learned about its directory, then the discovered
+// packages. History goes before discovery because it is what the team
+// actually writes.
+func (s repoScopes) fileScope(file string) (string, bool) {
+	for i, re := range s.regexes[:s.configured] {
+		if re.MatchString(file) {
+			return s.rules[i].Scope, true
+		}
+	}
+	if scope, ok := s.history.dirScope(file); ok {
+		return scope, true
+	}
+	for i, re := range s.regexes[s.configured:] {
+		if re.MatchString(file) {
+			return s.rules[s.configured+i].Scope, true
+		}
+	}
+	return "", false
+}
+
+// changeScopes is the set of scopes one change touches, the scope with the
+// most files first
+type changeScopes struct {
+	Allowed []string
+	Scopes  []string
+	Files   map[string]int
+}
+
+func (s repoScopes) forFiles(files []FileDiff) changeScopes {
+	change := changeScopes{Allowed: s.allowed, Files: map[string]int{}}
+	for _, f := range files {
+		if scope, ok := s.fileScope(f.Path()); ok {
+			if change.Files[scope] == 0 {
+				change.Scopes = append(change.Scopes, scope)
+			}
+			change.Files[scope]++
+		}
+	}
+	sort.SliceStable(change.Scopes, func(i, j int) bool {
+		return change.Files[change.Scopes[i]] > change.Files[change.Scopes[j]]
+	})
+	return change
+}
+
+// Spans reports a change that touches several scopes, which usually means
+// it should be more than one commit
+func (c changeScopes) Spans() bool {
+	return len(c.Scopes) > 1
+}
+
+// Warning tells the user about a change that spans scopes
+func (c changeScopes) Warning() string {
+	if !c.Spans() {
+		return ""
+	}
+	return fmt.Sprintf("touches %s; consider aicommit split", strings.Join(c.Scopes, ", "))
+}
+
+// prompt tells the model which scope the change belongs to
+func (c changeScopes) prompt() string {
+	switch len(c.Scopes) {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf("All changed files are in the %q scope, use it as the scope.\n", c.Scopes[0])
+	}
+	var parts []string
+	for _, scope := range c.Scopes {
+		parts = append(parts, fmt.Sprintf("%s (%d %s)", scope, c.Files[scope], plural(c.Files[scope], "file", "files")))
+	}
+	return fmt.Sprintf("The change spans several scopes: %s. Use the scope the change is mainly about, or leave the scope out if there is no such scope.\n", strings.Join(parts, ", "))
+}
+
+// constrain fixes the scope of a generated subject when the model picked
+// one that isn't allowed, or left it out although the change has exactly
+// one. Subjects that aren't Conventional Commits are left alone.
+func (c changeScopes) constrain(message string) string {
+	if len(c.Allowed) == 0 {
+		return message
+	}
+	subject, rest, hasRest := strings.Cut(message, "\n")
+	match := conventionalHeaderRegex.FindStringSubmatch(subject)
+	if match == nil {
+		return message
+	}
+	scope := match[2]
+	switch {
+	case scope != "" && scopeAllowed(scope, c.Allowed):
+		return message
+	case len(c.Scopes) == 1:
+		scope = c.Scopes[0]
+	default:
+		scope = ""
+	}
+	subject = match[1]
+	if scope != "" {
+		subject += "(" + scope + ")"
+	}
+	subject += match[3] + ": " + match[4]
+	if !hasRest {
+		return subject
+	}
+	return subject + "\n" + rest
+}
+
+// scopeAllowed accepts a scope, or a comma separated list of scopes, that
+// only names allowed ones
+func scopeAllowed(scope string, allowed []string) bool {
+	for _, part := range strings.Split(scope, ",") {
+		if !StringInSlice(strings.TrimSpace(part), allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveChangeScopes works out the scopes for a diff
+func resolveChangeScopes(config RepoConfig, files []FileDiff) (changeScopes, error) {
+	scopes, err := loadRepoScopes(config)
+	if err != nil {
+		return changeScopes{}, fmt.Errorf("could not work out the scopes: %w", err)
+	}
+	return scopes.forFiles(files), nil
+}
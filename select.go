@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// selectRow is one line of the selection view: a file, or one of its hunks.
+type selectRow struct {
+	file int
+	unit string // empty for the file line of a file whose hunks are listed separately
+}
+
+// selectionRows lists every file followed by its hunks. Files whose hunks
+// can't be picked separately are a single selectable row.
+func selectionRows(files []FileDiff, units []splitUnit) []selectRow {
+	var rows []selectRow
+	for i := range files {
+		var fileUnits []splitUnit
+		for _, unit := range units {
+			if unit.File == i {
+				fileUnits = append(fileUnits, unit)
+			}
+		}
+		if len(fileUnits) == 1 && fileUnits[0].Hunk < 0 {
+			rows = append(rows, selectRow{file: i, unit: fileUnits[0].ID})
+			continue
+		}
+		rows = append(rows, selectRow{file: i})
+		for _, unit := range fileUnits {
+			rows = append(rows, selectRow{file: i, unit: unit.ID})
+		}
+	}
+	return rows
+}
+
+// openSelection parses the current diff and shows it with everything
+// selected, keeping an earlier selection where the diff still matches.
+func (m model) openSelection() (model, tea.Cmd) {
+	// A fixed context keeps the hunks as git printed them, so selected
+	// ones can be applied again
+	gitDiff, _, err := getGitDiff(0)
+	if err != nil {
+		return m.showError(err)
+	}
+	files := ParseGitDiff(gitDiff)
+	units := splitUnits(files)
+
+	previous := m.selectState.selected
+	keepPrevious := m.selectState.active && m.selectState.diff == gitDiff
+	m.selectState.diff = gitDiff
+	m.selectState.files = files
+	m.selectState.units = units
+	m.selectState.rows = selectionRows(files, units)
+	m.selectState.selected = map[string]bool{}
+	for _, unit := range units {
+		m.selectState.selected[unit.ID] = !keepPrevious || previous[unit.ID]
+	}
+	m.selectState.cursor = 0
+	m.selectState.status = ""
+	m.view = SelectView
+	return m, tea.ClearScreen
+}
+
+func (m model) selectedIDs() []string {
+	var ids []string
+	for _, unit := range m.selectState.units {
+		if m.selectState.selected[unit.ID] {
+			ids = append(ids, unit.ID)
+		}
+	}
+	return ids
+}
+
+// selectedPatch is what gets sent to the model instead of the full diff.
+func (m model) selectedPatch() string {
+	return groupPatch(m.selectState.files, m.selectState.units, splitGroup{Units: m.selectedIDs()})
+}
+
+// toggleFile selects every unit of a file, or clears them all when they
+// were all selected already.
+func (m model) toggleFile(file int) {
+	all := true
+	for _, unit := range m.selectState.units {
+		if unit.File == file && !m.selectState.selected[unit.ID] {
+			all = false
+		}
+	}
+	for _, unit := range m.selectState.units {
+		if unit.File == file {
+			m.selectState.selected[unit.ID] = !all
+		}
+	}
+}
+
+func (m model) updateSelectView(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.terminalWidth = msg.Width
+		m.terminalHeight = msg.Height
+		return m, nil
+	case tea.KeyMsg:
+		rows := m.selectState.rows
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		case "esc", "q":
+			m.view = CommitMessageView
+			return m, tea.ClearScreen
+		case "up", "k":
+			if m.selectState.cursor > 0 {
+				m.selectState.cursor--
+			}
+		case "down", "j":
+			if m.selectState.cursor < len(rows)-1 {
+				m.selectState.cursor++
+			}
+		case " ", "x":
+			row := rows[m.selectState.cursor]
+			if row.unit == "" {
+				m.toggleFile(row.file)
+			} else {
+				m.selectState.selected[row.unit] = !m.selectState.selected[row.unit]
+			}
+		case "a":
+			all := len(m.selectedIDs()) == len(m.selectState.units)
+			for id := range m.selectState.selected {
+				m.selectState.selected[id] = !all
+			}
+		case "t":
+			m.selectState.stage = !m.selectState.stage
+		case "c":
+			// Back to describing the whole diff
+			m.selectState.active = false
+			m.view = CommitMessageView
+			return m, tea.ClearScreen
+		case "enter":
+			if len(m.selectedIDs()) == 0 {
+				m.selectState.status = "Select at least one change"
+				return m, nil
+			}
+			if m.selectState.stage {
+				if err := stageSelection(m.selectState.files, m.selectState.units, m.selectedIDs()); err != nil {
+					return m.showError(err)
+				}
+			}
+			m.selectState.active = true
+			return m.startGeneration()
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m model) viewSelectView() string {
+	var b strings.Builder
+	b.WriteString("\n Pick the changes the message should describe\n\n")
+	for i, row := range m.selectState.rows {
+		f := m.selectState.files[row.file]
+		pointer := "  "
+		if i == m.selectState.cursor {
+			pointer = "> "
+		}
+
+		var checked bool
+		var label string
+		if row.unit == "" {
+			checked = true
+			for _, unit := range m.selectState.units {
+				if unit.File == row.file && !m.selectState.selected[unit.ID] {
+					checked = false
+				}
+			}
+			label = f.Path()
+		} else {
+			checked = m.selectState.selected[row.unit]
+			label = f.Path()
+			for _, unit := range m.selectState.units {
+				if unit.ID == row.unit && unit.Hunk >= 0 {
+					hunk := f.Hunks[unit.Hunk]
+					label = "    " + hunk.renderHeader(hunk.NewStart)
+				}
+			}
+		}
+		box := "[ ]"
+		if checked {
+			box = "[x]"
+		}
+		fmt.Fprintf(&b, " %s%s %s\n", pointer, box, label)
+	}
+
+	stage := "no"
+	if m.selectState.stage {
+		stage = "yes"
+	}
+	fmt.Fprintf(&b, "\n %d of %d changes selected • stage only the selection: %s\n", len(m.selectedIDs()), len(m.selectState.units), stage)
+	if m.selectState.status != "" {
+		fmt.Fprintf(&b, " %s\n", m.selectState.status)
+	}
+	b.WriteString("\n " + helpStyle.Render("↑/↓ move • space toggle • a toggle all • t toggle staging • enter generate • c use whole diff • esc back") + "\n")
+	return mainContentStyle.Width(m.terminalWidth).Render(b.String())
+}
+
+// stageSelection makes the index hold exactly the selected changes. Fully
+// selected files are added from the working tree; partly selected ones get
+// their hunks applied to the index. On failure the index is restored.
+func stageSelection(files []FileDiff, units []splitUnit, ids []string) (err error) {
+	origIndex, err := runGit("write-tree")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if _, readErr := runGit("read-tree", origIndex); readErr != nil {
+			err = errors.Join(err, readErr)
+		}
+	}()
+
+	if _, err = runGit("read-tree", "HEAD"); err != nil {
+		return err
+	}
+	for i, f := range files {
+		var hunks []int
+		all := true
+		for _, unit := range units {
+			if unit.File != i {
+				continue
+			}
+			if !StringInSlice(unit.ID, ids) {
+				all = false
+				continue
+			}
+			if unit.Hunk < 0 {
+				hunks = f.AllHunks()
+			} else {
+				hunks = append(hunks, unit.Hunk)
+			}
+		}
+
+		if all {
+			args := []string{"add", "-A", "--"}
+			for _, path := range []string{f.OldPath, f.NewPath} {
+				if path != "" && path != "/dev/null" && !StringInSlice(path, args) {
+					args = append(args, path)
+				}
+			}
+			if _, err = runGit(args...); err != nil {
+				return err
+			}
+		} else if len(hunks) > 0 {
+			if _, err = runGitRaw(f.Patch(hunks), "apply", "--cached", "--recount", "-"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
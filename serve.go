@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/spf13/cobra"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+// Editors talk to the server with JSON-RPC 2.0, one message per line, over
+// a Unix socket or stdio. Over HTTP every POST to /rpc carries one request
+// and gets its notifications and response back as lines of one stream.
+//
+// Methods:
+//
+//	generate    {staged, stream, ticket, language, subject_only} -> {message, status, model}
+//	regenerate  the same plus {previous}; previous defaults to the last message on the connection
+//	history     {limit} -> [{message, sha, date}]
+//	config      -> the profile and the repository config
+//	config/set  {model, language}
+//	cancel      {id}, also accepted as the notification $/cancelRequest
+//
+// While a streamed generate runs the server sends generate/chunk
+// notifications with the request id and the next piece of the message, and
+// generate/status notifications when it waits for a retry.
+
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcCancelled      = -32800 // as in the Language Server Protocol
+)
+
+// maxRPCMessageBytes bounds a single request; diffs are read by the server
+// itself, so requests are small
+const maxRPCMessageBytes = 1 << 20
+
+// defaultHistoryLimit is how many entries history returns without a limit
+const defaultHistoryLimit = 20
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type generateParams struct {
+	Repo        string `json:"repo"`
+	Staged      bool   `json:"staged"`
+	Stream      bool   `json:"stream"`
+	Ticket      string `json:"ticket"`
+	Language    string `json:"language"`
+	SubjectOnly bool   `json:"subject_only"`
+	Previous    string `json:"previous"`
+}
+
+type generateResult struct {
+	Message string `json:"message"`
+	Status  string `json:"status,omitempty"`
+	Model   string `json:"model"`
+}
+
+type historyEntry struct {
+	Message string    `json:"message"`
+	SHA     string    `json:"sha,omitempty"` // empty for messages that were only generated
+	Date    time.Time `json:"date"`
+}
+
+type configResult struct {
+	Repo           string     `json:"repo"`
+	Provider       string     `json:"provider"`
+	Model          string     `json:"model"`
+	Language       string     `json:"language"`
+	TimeoutSeconds int        `json:"timeout_seconds"`
+	MaxRetries     int        `json:"max_retries"`
+	RepoConfig     RepoConfig `json:"repo_config"`
+}
+
+type configSetParams struct {
+	Model    *string `json:"model"`
+	Language *string `json:"language"`
+}
+
+// toRPCError keeps the title and fix of our errors, so editors can show
+// them the way the TUI does
+func toRPCError(ctx context.Context, err error) *rpcError {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if ctx.Err() != nil {
+		return &rpcError{Code: rpcCancelled, Message: "request cancelled"}
+	}
+	appErr := asAppError(err)
+	return &rpcError{
+		Code:    rpcInternalError,
+		Message: appErr.Error(),
+		Data:    map[string]string{"title": appErr.Title(), "fix": appErr.Fix()},
+	}
+}
+
+// ---------------- Server ----------------
+
+// rpcServer serves one repository, the one it was started in, since the
+// whole pipeline works on the current directory. Any number of editors can
+// connect to it at once.
+type rpcServer struct {
+	cdb  *CommitDB
+	root string
+}
+
+// rpcConn is one client. Its requests run concurrently; writes are
+// serialised so messages don't interleave.
+type rpcConn struct {
+	server   *rpcServer
+	write    func(message any) error
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+	last     string // the last generated message, for regenerate
+	gone     context.CancelFunc
+}
+
+func (s *rpcServer) newConn(write func(message any) error, gone context.CancelFunc) *rpcConn {
+	return &rpcConn{server: s, write: write, inflight: map[string]context.CancelFunc{}, gone: gone}
+}
+
+// send writes a message. A failed write means the client went away, so
+// everything it asked for is cancelled.
+func (c *rpcConn) send(message any) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.write(message); err != nil {
+		log.Debug().Err(err).Msg("client went away")
+		c.gone()
+	}
+}
+
+func (c *rpcConn) notify(method string, params any) {
+	c.send(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle runs one request and answers it, unless it is a notification
+func (c *rpcConn) handle(ctx context.Context, line []byte) {
+	var req rpcRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		c.send(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+		return
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		c.send(rpcResponse{JSONRPC: "2.0", ID: idOrNull(req.ID), Error: &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}})
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	key := string(req.ID)
+	if key != "" {
+		c.mu.Lock()
+		c.inflight[key] = cancel
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			delete(c.inflight, key)
+			c.mu.Unlock()
+		}()
+	}
+
+	result, err := c.dispatch(ctx, req)
+	if key == "" {
+		return
+	}
+	if err != nil {
+		c.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: toRPCError(ctx, err)})
+		return
+	}
+	c.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func decodeParams(raw json.RawMessage, params any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, params); err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (c *rpcConn) dispatch(ctx context.Context, req rpcRequest) (any, error) {
+	switch req.Method {
+	case "generate", "regenerate":
+		var params generateParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if req.Method == "regenerate" && params.Previous == "" {
+			c.mu.Lock()
+			params.Previous = c.last
+			c.mu.Unlock()
+			if params.Previous == "" {
+				return nil, &rpcError{Code: rpcInvalidParams, Message: "nothing to regenerate, pass previous or call generate first"}
+			}
+		}
+		result, err := c.server.generate(ctx, params, req.ID, c.notify)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.last = result.Message
+		c.mu.Unlock()
+		return result, nil
+	case "history":
+		var params struct {
+			Limit int64 `json:"limit"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return c.server.history(params.Limit)
+	case "config":
+		return c.server.config()
+	case "config/set":
+		var params configSetParams
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return c.server.setConfig(params)
+	case "cancel", "$/cancelRequest":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := decodeParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		cancel, ok := c.inflight[string(params.ID)]
+		c.mu.Unlock()
+		if ok {
+			cancel()
+		}
+		return map[string]bool{"cancelled": ok}, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+}
+
+// checkRepo makes sure a request is about the repository this server serves
+func (s *rpcServer) checkRepo(repo string) error {
+	if repo == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(repo)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+	}
+	if abs != s.root && !strings.HasPrefix(abs, s.root+string(filepath.Separator)) {
+		return &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("this server serves %s, not %s", s.root, abs)}
+	}
+	return nil
+}
+
+func (s *rpcServer) generate(ctx context.Context, params generateParams, id json.RawMessage, notify func(method string, params any)) (generateResult, error) {
+	if err := s.checkRepo(params.Repo); err != nil {
+		return generateResult{}, err
+	}
+	// Settings are read for every request, so changes made in the TUI or
+	// through config/set apply right away
+	client, err := loadLLMClient(s.cdb)
+	if err != nil {
+		return generateResult{}, err
+	}
+	client.onRetry = func(status RetryStatus) {
+		notify("generate/status", map[string]any{"id": id, "status": status.String()})
+	}
+	catalog, err := LoadModelCatalog(s.cdb)
+	if err != nil {
+		return generateResult{}, err
+	}
+	modelInfo, _ := catalog.Lookup(client.provider, client.model)
+
+	diffArgs := []string{"HEAD"}
+	var diff string
+	var usedContext diffContext
+	if params.Staged {
+		diffArgs = []string{"--cached"}
+		diff, usedContext, err = getStagedDiff(diffTokenBudget(modelInfo))
+	} else {
+		diff, usedContext, err = getGitDiff(diffTokenBudget(modelInfo))
+	}
+	if err != nil {
+		return generateResult{}, err
+	}
+	diffCommand := usedContext.Command(diffArgs...)
+
+	var stream func(chunk string) error
+	if params.Stream {
+		stream = func(chunk string) error {
+			notify("generate/chunk", map[string]any{"id": id, "chunk": chunk})
+			return ctx.Err()
+		}
+	}
+	generated, err := writeCommitMessage(ctx, s.cdb, client, modelInfo, messageRequest{
+		Diff:            diff,
+		Context:         usedContext,
+		Previous:        params.Previous,
+		Ticket:          params.Ticket,
+		Language:        params.Language,
+		ProfileLanguage: client.language,
+		SubjectOnly:     params.SubjectOnly,
+	}, stream)
+	if err != nil {
+		return generateResult{}, err
+	}
+
+	dateCreated := time.Now()
+	if _, err := s.cdb.InsertCommit(dbmodel.Commits{
+		CommitMessage:        &generated.Message,
+		GitDiffCommand:       &diffCommand,
+		GitDiffCommandOutput: &diff,
+		DateCreated:          &dateCreated,
+	}); err != nil {
+		log.Error().Err(err).Msg("could not record the generated message")
+	}
+	return generateResult{Message: generated.Message, Status: generated.Status, Model: client.model}, nil
+}
+
+func (s *rpcServer) history(limit int64) ([]historyEntry, error) {
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	commits, err := s.cdb.GetCommits(limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := []historyEntry{}
+	for _, commit := range commits {
+		entry := historyEntry{Message: derefString(commit.CommitMessage), SHA: derefString(commit.Sha)}
+		if commit.DateCreated != nil {
+			entry.Date = *commit.DateCreated
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *rpcServer) config() (configResult, error) {
+	userSettings, err := s.cdb.GetUserSettings()
+	if err != nil {
+		return configResult{}, err
+	}
+	repoConfig, err := loadRepoConfig()
+	if err != nil {
+		return configResult{}, err
+	}
+	limits := requestLimitsFromSettings(userSettings)
+	return configResult{
+		Repo:           s.root,
+		Provider:       derefString(userSettings.AiProvider),
+		Model:          derefString(userSettings.ModelSelection),
+		Language:       derefString(userSettings.Language),
+		TimeoutSeconds: int(limits.Timeout / time.Second),
+		MaxRetries:     limits.MaxRetries,
+		RepoConfig:     repoConfig,
+	}, nil
+}
+
+// setConfig changes the profile. Only what editors commonly switch is
+// offered; everything else stays in the TUI's settings.
+func (s *rpcServer) setConfig(params configSetParams) (configResult, error) {
+	if params.Model != nil {
+		userSettings, err := s.cdb.GetUserSettings()
+		if err != nil {
+			return configResult{}, err
+		}
+		catalog, err := LoadModelCatalog(s.cdb)
+		if err != nil {
+			return configResult{}, err
+		}
+		if _, ok := catalog.Lookup(derefString(userSettings.AiProvider), *params.Model); !ok {
+			return configResult{}, &rpcError{Code: rpcInvalidParams, Message: fmt.Sprintf("model %q is not in the catalog, see aicommit models list", *params.Model)}
+		}
+	}
+	if _, err := s.cdb.UpdateUserSettings(dbmodel.UserSettings{
+		ModelSelection: params.Model,
+		Language:       params.Language,
+	}); err != nil {
+		return configResult{}, err
+	}
+	return s.config()
+}
+
+// ---------------- Transports ----------------
+
+// serveStream serves one client that sends a request per line. When the
+// client stops sending, the requests it already sent still get answered.
+func (s *rpcServer) serveStream(ctx context.Context, r io.Reader, w io.Writer) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	encoder := json.NewEncoder(w)
+	conn := s.newConn(encoder.Encode, cancel)
+
+	var wg sync.WaitGroup
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRPCMessageBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		line = append([]byte(nil), line...)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.handle(ctx, line)
+		}()
+	}
+	if err := scanner.Err(); err != nil {
+		log.Debug().Err(err).Msg("could not read from the client")
+	}
+	wg.Wait()
+}
+
+func (s *rpcServer) serveListener(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		client, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer client.Close()
+			// Shutting down closes the connection, which ends the read loop
+			stop := context.AfterFunc(ctx, func() { client.Close() })
+			defer stop()
+			s.serveStream(ctx, client, client)
+		}()
+	}
+}
+
+func (s *rpcServer) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		if !checkHostHeader(r.Host) {
+			http.Error(w, "only requests to localhost are served", http.StatusForbidden)
+			return
+		}
+		// Browsers can't send JSON to another origin without asking first,
+		// which keeps web pages from using the server
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRPCMessageBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		encoder := json.NewEncoder(w)
+		// Closing the connection cancels the request
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		conn := s.newConn(func(message any) error {
+			if err := encoder.Encode(message); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		}, cancel)
+		conn.handle(ctx, bytes.TrimSpace(body))
+	})
+	return mux
+}
+
+// defaultSocketPath keeps the socket in the git directory, so every
+// repository gets its own and editors can find it
+func defaultSocketPath() (string, error) {
+	gitDir, err := runGit("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "aicommit.sock"), nil
+}
+
+// listenUnix listens on a socket, replacing a stale one left by a server
+// that didn't shut down cleanly
+func listenUnix(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if probe, err := net.Dial("unix", path); err == nil {
+			probe.Close()
+			return nil, fmt.Errorf("a server is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	// The socket is created owner-only, chmod afterwards would leave a
+	// window where others can connect
+	var listener net.Listener
+	err := withUmask(0o177, func() error {
+		var err error
+		listener, err = net.Listen("unix", path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func isLoopbackHost(host string) bool {
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback())
+}
+
+// checkLoopback refuses to serve anyone but the local machine
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("--http must listen on localhost or a loopback address, not %q", host)
+	}
+	return nil
+}
+
+// checkHostHeader defeats DNS rebinding: a page on a name that resolves to
+// 127.0.0.1 counts as same-origin there, but its requests still carry its
+// own name in Host
+func checkHostHeader(hostHeader string) bool {
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	return isLoopbackHost(host)
+}
+
+// ---------------- CLI ----------------
+
+func newServeCmd(cdb *CommitDB) *cobra.Command {
+	var socketPath string
+	var httpAddr string
+	var stdio bool
+	cmdServe := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve commit messages to editors over JSON-RPC",
+		Long: "Runs a server for editor integrations that generates messages for the repository it was started in. " +
+			"It listens on a Unix socket in the git directory by default, on localhost with --http, or talks JSON-RPC over stdin and stdout with --stdio. " +
+			"Methods: generate, regenerate, history, config, config/set and cancel.",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// stdout may be the protocol, so anything else goes to stderr
+			fail := func(err error) error {
+				fmt.Fprintln(os.Stderr, asAppError(err).Error())
+				return err
+			}
+			log.DefaultLogger.Writer = &log.IOWriter{Writer: os.Stderr}
+
+			root, err := runGit("rev-parse", "--show-toplevel")
+			if err != nil {
+				return fail(err)
+			}
+			if root, err = filepath.EvalSymlinks(root); err != nil {
+				return fail(err)
+			}
+			server := &rpcServer{cdb: cdb, root: root}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			switch {
+			case stdio:
+				// Reading stdin can't be interrupted, so a signal doesn't
+				// wait for it
+				done := make(chan struct{})
+				go func() {
+					server.serveStream(ctx, os.Stdin, os.Stdout)
+					close(done)
+				}()
+				select {
+				case <-done:
+				case <-ctx.Done():
+				}
+				return nil
+			case httpAddr != "":
+				if err := checkLoopback(httpAddr); err != nil {
+					return fail(err)
+				}
+				listener, err := net.Listen("tcp", httpAddr)
+				if err != nil {
+					return fail(err)
+				}
+				httpServer := &http.Server{Handler: server.httpHandler(), ReadHeaderTimeout: 10 * time.Second}
+				go func() {
+					<-ctx.Done()
+					shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					httpServer.Shutdown(shutdownCtx)
+				}()
+				fmt.Fprintf(os.Stderr, "Serving %s on http://%s/rpc\n", root, listener.Addr())
+				if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					return fail(err)
+				}
+				return nil
+			default:
+				if socketPath == "" {
+					if socketPath, err = defaultSocketPath(); err != nil {
+						return fail(err)
+					}
+				}
+				listener, err := listenUnix(socketPath)
+				if err != nil {
+					return fail(err)
+				}
+				defer os.Remove(socketPath)
+				go func() {
+					<-ctx.Done()
+					listener.Close()
+				}()
+				fmt.Fprintf(os.Stderr, "Serving %s on %s\n", root, socketPath)
+				if err := server.serveListener(ctx, listener); err != nil {
+					return fail(err)
+				}
+				return nil
+			}
+		},
+	}
+	cmdServe.Flags().StringVar(&socketPath, "socket", "", "Unix socket to listen on (default .git/aicommit.sock)")
+	cmdServe.Flags().StringVar(&httpAddr, "http", "", "listen for HTTP on this localhost address instead, e.g. 127.0.0.1:7317")
+	cmdServe.Flags().BoolVar(&stdio, "stdio", false, "talk JSON-RPC over stdin and stdout instead")
+	cmdServe.MarkFlagsMutuallyExclusive("socket", "http", "stdio")
+	return cmdServe
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+const splitPlanPrompt = `You split a working tree into several small, coherent git commits.
+You get a list of changes, each with an ID. Group the IDs into commits so that each commit does one thing.
+Every ID must appear in exactly one commit. Order the commits so that each one builds on the previous ones.
+Answer with JSON only, in this form:
+{"commits": [{"title": "short description of the commit", "units": ["1.0", "2"]}]}`
+
+// maxPlanHunkLines keeps the planning prompt small; the planner only needs
+// enough of each hunk to see what it is about.
+const maxPlanHunkLines = 40
+
+// splitUnit is the smallest piece of a change the planner can move between
+// commits: one hunk, or a whole file when its hunks can't be applied
+// separately.
+type splitUnit struct {
+	ID   string
+	File int
+	Hunk int // -1 for the whole file
+}
+
+type splitGroup struct {
+	Title string   `json:"title"`
+	Units []string `json:"units"`
+}
+
+type splitPlan struct {
+	Groups []splitGroup `json:"commits"`
+}
+
+// isWholeFileChange reports whether the change does more than modify the
+// content of an existing file, in which case its hunks must stay together.
+func isWholeFileChange(f FileDiff) bool {
+	return len(f.Hunks) == 0 || f.Status != FileModified || f.IsBinary || f.IsSubmodule || f.ModeChanged()
+}
+
+func splitUnits(files []FileDiff) []splitUnit {
+	var units []splitUnit
+	for i, f := range files {
+		if isWholeFileChange(f) {
+			units = append(units, splitUnit{ID: strconv.Itoa(i + 1), File: i, Hunk: -1})
+			continue
+		}
+		for j := range f.Hunks {
+			units = append(units, splitUnit{ID: fmt.Sprintf("%d.%d", i+1, j), File: i, Hunk: j})
+		}
+	}
+	return units
+}
+
+// describeUnits renders the units for the planning prompt.
+func describeUnits(files []FileDiff, units []splitUnit) string {
+	var b strings.Builder
+	for _, unit := range units {
+		f := files[unit.File]
+		fmt.Fprintf(&b, "### ID %s: %s\n", unit.ID, f.Path())
+		if kind := ClassifyFile(f); kind != KindSource {
+			b.WriteString(CondenseDiff([]FileDiff{f}).Summaries[0] + "\n\n")
+			continue
+		}
+		var lines []string
+		if unit.Hunk < 0 {
+			lines = f.Header
+			for _, hunk := range f.Hunks {
+				lines = append(lines, strings.Split(hunk.String(), "\n")...)
+			}
+		} else {
+			lines = strings.Split(f.Hunks[unit.Hunk].String(), "\n")
+		}
+		if len(lines) > maxPlanHunkLines {
+			lines = append(lines[:maxPlanHunkLines], fmt.Sprintf("... %d more lines", len(lines)-maxPlanHunkLines))
+		}
+		b.WriteString(strings.Join(lines, "\n"))
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
+
+// normalizePlan drops unknown and duplicate IDs and collects anything the
+// planner forgot into a final group, so every unit is committed exactly once.
+func normalizePlan(plan splitPlan, units []splitUnit) splitPlan {
+	known := map[string]bool{}
+	for _, unit := range units {
+		known[unit.ID] = true
+	}
+	seen := map[string]bool{}
+	var normalized splitPlan
+	for _, group := range plan.Groups {
+		var ids []string
+		for _, id := range group.Units {
+			if known[id] && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			normalized.Groups = append(normalized.Groups, splitGroup{Title: group.Title, Units: ids})
+		}
+	}
+	var rest []string
+	for _, unit := range units {
+		if !seen[unit.ID] {
+			rest = append(rest, unit.ID)
+		}
+	}
+	if len(rest) > 0 {
+		normalized.Groups = append(normalized.Groups, splitGroup{Title: "Remaining changes", Units: rest})
+	}
+	return normalized
+}
+
+func planSplit(ctx context.Context, client *llmClient, files []FileDiff, units []splitUnit) (splitPlan, error) {
+	answer, err := client.Complete(ctx, splitPlanPrompt, describeUnits(files, units), nil)
+	if err != nil {
+		return splitPlan{}, err
+	}
+	raw, err := extractJSON(answer)
+	if err != nil {
+		return splitPlan{}, err
+	}
+	var plan splitPlan
+	if err := json.Unmarshal([]byte(raw), &plan); err != nil {
+		return splitPlan{}, fmt.Errorf("could not read the split plan: %w", err)
+	}
+	return normalizePlan(plan, units), nil
+}
+
+// groupPatch builds the patch for one group, keeping the files in diff order.
+func groupPatch(files []FileDiff, units []splitUnit, group splitGroup) string {
+	byID := map[string]splitUnit{}
+	for _, unit := range units {
+		byID[unit.ID] = unit
+	}
+	hunksByFile := map[int][]int{}
+	var fileOrder []int
+	for _, id := range group.Units {
+		unit := byID[id]
+		if _, ok := hunksByFile[unit.File]; !ok {
+			fileOrder = append(fileOrder, unit.File)
+		}
+		if unit.Hunk < 0 {
+			hunksByFile[unit.File] = files[unit.File].AllHunks()
+		} else {
+			hunksByFile[unit.File] = append(hunksByFile[unit.File], unit.Hunk)
+		}
+	}
+	sort.Ints(fileOrder)
+
+	var b strings.Builder
+	for _, i := range fileOrder {
+		b.WriteString(files[i].Patch(hunksByFile[i]))
+	}
+	return b.String()
+}
+
+// splitCommit is a group that is ready to be committed.
+type splitCommit struct {
+	Patch   string
+	Message string
+	SHA     string
+}
+
+// commitSplit stages and commits each patch in turn. The working tree is
+// never touched; on failure HEAD and the index are put back as they were.
+func commitSplit(ctx context.Context, commits []splitCommit, progress func(string)) (result []splitCommit, err error) {
+	origHead, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	origIndex, err := runGit("write-tree")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		_, resetErr := runGit("reset", "--soft", origHead)
+		_, readErr := runGit("read-tree", origIndex)
+		if rollbackErr := errors.Join(resetErr, readErr); rollbackErr != nil {
+			err = fmt.Errorf("%w (rolling back also failed: %v; HEAD was %s, index tree was %s)", err, rollbackErr, origHead, origIndex)
+		}
+	}()
+
+	// Start from HEAD so that previously staged changes don't leak into the
+	// first commit
+	if _, err = runGit("read-tree", "HEAD"); err != nil {
+		return nil, err
+	}
+	for i, commit := range commits {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		progress(fmt.Sprintf("Committing %d/%d: %s", i+1, len(commits), firstLine(commit.Message)))
+		if _, err = runGitRaw(commit.Patch, "apply", "--cached", "--recount", "-"); err != nil {
+			return nil, err
+		}
+		if _, err = runGit("commit", "--quiet", "-m", commit.Message); err != nil {
+			return nil, err
+		}
+		if commit.SHA, err = runGit("rev-parse", "--short", "HEAD"); err != nil {
+			return nil, err
+		}
+		result = append(result, commit)
+	}
+	return result, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// ---------------- TUI ----------------
+
+type splitState int
+
+const (
+	splitPlanning splitState = iota
+	splitEditing
+	splitRunning
+	splitDone
+	splitFailed
+)
+
+type splitPlanMsg struct {
+	plan splitPlan
+}
+
+type splitDoneMsg struct {
+	commits []splitCommit
+}
+
+type splitModel struct {
+	state    splitState
+	client   *llmClient
+	files    []FileDiff
+	units    []splitUnit
+	plan     splitPlan
+	skipped  map[string]bool // units left out of every commit
+	cursor   int             // index into the flattened units of the plan
+	spinner  spinner.Model
+	progress chan string
+	status   string
+	commits  []splitCommit
+	err      *AppError
+	cancel   context.CancelFunc
+	ctx      context.Context
+	width    int
+
+	overrides messageOverrides
+}
+
+func newSplitModel(client *llmClient, files []FileDiff, overrides messageOverrides) splitModel {
+	ctx, cancel := context.WithCancel(context.Background())
+	return splitModel{
+		state:    splitPlanning,
+		client:   client,
+		files:    files,
+		units:    splitUnits(files),
+		skipped:  map[string]bool{},
+		spinner:  spinner.New(),
+		progress: make(chan string),
+		ctx:      ctx,
+		cancel:   cancel,
+
+		overrides: overrides,
+	}
+}
+
+func (m splitModel) Init() tea.Cmd {
+	ctx, client, files, units := m.ctx, m.client, m.files, m.units
+	return tea.Batch(m.spinner.Tick, waitForActivity(m.progress), func() tea.Msg {
+		plan, err := planSplit(ctx, client, files, units)
+		if err != nil {
+			return errMsg{err}
+		}
+		return splitPlanMsg{plan}
+	})
+}
+
+// position maps the cursor to a group and a unit within it.
+func (m splitModel) position() (int, int) {
+	n := m.cursor
+	for g, group := range m.plan.Groups {
+		if n < len(group.Units) {
+			return g, n
+		}
+		n -= len(group.Units)
+	}
+	return -1, -1
+}
+
+func (m splitModel) unitCount() int {
+	count := 0
+	for _, group := range m.plan.Groups {
+		count += len(group.Units)
+	}
+	return count
+}
+
+// moveUnit moves the unit under the cursor to the neighbouring group, making
+// a new group when moving past the last one.
+func (m splitModel) moveUnit(direction int) splitModel {
+	g, u := m.position()
+	if g < 0 {
+		return m
+	}
+	target := g + direction
+	if target < 0 {
+		return m
+	}
+	groups := make([]splitGroup, len(m.plan.Groups))
+	copy(groups, m.plan.Groups)
+	if target == len(groups) {
+		groups = append(groups, splitGroup{Title: "New commit"})
+	}
+	id := groups[g].Units[u]
+	groups[g].Units = append(append([]string{}, groups[g].Units[:u]...), groups[g].Units[u+1:]...)
+	groups[target].Units = append(append([]string{}, groups[target].Units...), id)
+
+	var kept []splitGroup
+	cursor := 0
+	for i, group := range groups {
+		if len(group.Units) == 0 {
+			continue
+		}
+		if i == target {
+			m.cursor = cursor + len(group.Units) - 1
+		}
+		cursor += len(group.Units)
+		kept = append(kept, group)
+	}
+	m.plan.Groups = kept
+	return m
+}
+
+func (m splitModel) commitPlan() tea.Cmd {
+	ctx, client, files, units, progress := m.ctx, m.client, m.files, m.units, m.progress
+	overrides := m.overrides
+	var groups []splitGroup
+	for _, group := range m.plan.Groups {
+		var ids []string
+		for _, id := range group.Units {
+			if !m.skipped[id] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			groups = append(groups, splitGroup{Title: group.Title, Units: ids})
+		}
+	}
+	return func() tea.Msg {
+		report := func(status string) {
+			select {
+			case progress <- status:
+			case <-ctx.Done():
+			}
+		}
+		repoConfig, err := loadRepoConfig()
+		if err != nil {
+			return errMsg{err}
+		}
+		repoConfig = overrides.apply(repoConfig)
+		ticket := currentTicket(repoConfig.Ticket, overrides.Ticket)
+		lang := messageLanguage(repoConfig, client.language, overrides.Language)
+		scopes, err := loadRepoScopes(repoConfig)
+		if err != nil {
+			return errMsg{err}
+		}
+		// Generate every message before touching the repository, so a
+		// provider failure leaves nothing to roll back
+		var commits []splitCommit
+		for i, group := range groups {
+			report(fmt.Sprintf("Writing message %d/%d: %s", i+1, len(groups), group.Title))
+			patch := groupPatch(files, units, group)
+			groupFiles := ParseGitDiff(patch)
+			change := scopes.forFiles(groupFiles)
+			groupConfig := repoConfig
+			groupConfig.Lint.Scopes = change.Allowed
+			prompt := CondenseDiff(groupFiles).String()
+			message, err := completeInLanguage(ctx, client, lang, commitMessageSystemPrompt(groupConfig, ticket, lang)+change.prompt(), prompt, nil)
+			if err != nil {
+				return errMsg{err}
+			}
+			message, err = finishMessage(message, groupConfig, ticket, nil)
+			if err != nil {
+				return errMsg{err}
+			}
+			message = change.constrain(message)
+			commits = append(commits, splitCommit{Patch: patch, Message: message})
+		}
+		commits, err = commitSplit(ctx, commits, report)
+		if err != nil {
+			return errMsg{err}
+		}
+		return splitDoneMsg{commits}
+	}
+}
+
+func (m splitModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		return m, nil
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		if m.state == splitPlanning || m.state == splitRunning {
+			m.spinner, cmd = m.spinner.Update(msg)
+		}
+		return m, cmd
+	case responseMsg:
+		m.status = msg.messageContent
+		return m, waitForActivity(m.progress)
+	case splitPlanMsg:
+		m.plan = msg.plan
+		m.state = splitEditing
+		return m, nil
+	case splitDoneMsg:
+		m.commits = msg.commits
+		m.state = splitDone
+		return m, nil
+	case errMsg:
+		m.err = asAppError(msg.err)
+		m.state = splitFailed
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			m.cancel()
+			return m, tea.Quit
+		case "q", "esc":
+			// Quitting mid-commit would leave a half-split history behind;
+			// cancelling makes commitSplit roll back instead
+			m.cancel()
+			if m.state == splitRunning {
+				return m, nil
+			}
+			return m, tea.Quit
+		}
+		if m.state != splitEditing {
+			return m, nil
+		}
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < m.unitCount()-1 {
+				m.cursor++
+			}
+		case "left", "h":
+			m = m.moveUnit(-1)
+		case "right", "l":
+			m = m.moveUnit(1)
+		case "d", " ":
+			if g, u := m.position(); g >= 0 {
+				id := m.plan.Groups[g].Units[u]
+				m.skipped[id] = !m.skipped[id]
+			}
+		case "enter":
+			m.state = splitRunning
+			return m, tea.Batch(m.commitPlan(), m.spinner.Tick)
+		}
+		return m, nil
+	}
+	return m, nil
+}
+
+func (m splitModel) View() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	switch m.state {
+	case splitPlanning:
+		fmt.Fprintf(&b, " %s Asking %s to group %d changes into commits...\n", m.spinner.View(), m.client.model, len(m.units))
+	case splitRunning:
+		fmt.Fprintf(&b, " %s %s\n", m.spinner.View(), m.status)
+	case splitFailed:
+		keys := []string{"q quit"}
+		return renderError(m.err, keys, m.width)
+	case splitDone:
+		fmt.Fprintf(&b, " Created %d commits:\n\n", len(m.commits))
+		for _, commit := range m.commits {
+			fmt.Fprintf(&b, "   %s %s\n", commit.SHA, firstLine(commit.Message))
+		}
+		b.WriteString("\n " + helpStyle.Render("q quit") + "\n")
+	case splitEditing:
+		byID := map[string]splitUnit{}
+		for _, unit := range m.units {
+			byID[unit.ID] = unit
+		}
+		index := 0
+		for g, group := range m.plan.Groups {
+			fmt.Fprintf(&b, " %d. %s\n", g+1, group.Title)
+			for _, id := range group.Units {
+				unit := byID[id]
+				f := m.files[unit.File]
+				label := f.Path()
+				if unit.Hunk >= 0 {
+					hunk := f.Hunks[unit.Hunk]
+					label = fmt.Sprintf("%s %s", label, hunk.renderHeader(hunk.NewStart))
+				}
+				pointer := "  "
+				if index == m.cursor {
+					pointer = "> "
+				}
+				line := fmt.Sprintf("   %s[%s] %s", pointer, id, label)
+				if m.skipped[id] {
+					line = helpStyle.Render(line + " (not committed)")
+				}
+				b.WriteString(line + "\n")
+				index++
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString(" " + helpStyle.Render("↑/↓ select • ←/→ move to previous/next commit • d leave uncommitted • enter commit • q abort") + "\n")
+	}
+	return mainContentStyle.Width(m.width).Render(b.String())
+}
+
+// ---------------- CLI ----------------
+
+func newSplitCmd(cdb *CommitDB) *cobra.Command {
+	return &cobra.Command{
+		Use:           "split",
+		Short:         "Split the working tree into several commits using AI",
+		Long:          "Groups the changes to tracked files into logical commits, lets you edit the grouping and commits each group with its own generated message.",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := loadLLMClient(cdb)
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			diff, err := runGitRaw("", "diff", "--binary", "HEAD")
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			files := ParseGitDiff(diff)
+			if len(files) == 0 {
+				err := newAppError(ErrNoChanges, errors.New("no changes to tracked files"))
+				showFatalError(err)
+				return err
+			}
+
+			finalModel, err := tea.NewProgram(newSplitModel(client, files, messageOverridesFromFlags(cmd))).Run()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "could not start program:", err)
+				return err
+			}
+			if m, ok := finalModel.(splitModel); ok && m.err != nil {
+				return m.err
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// findTicket returns the first match of the patterns in a branch name or
+// message, or its first capture group when the pattern has one
+func findTicket(text string, patterns []string) string {
+	for _, pattern := range patterns {
+		ticketRegex, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		match := ticketRegex.FindStringSubmatch(text)
+		switch {
+		case len(match) > 1 && match[1] != "":
+			return match[1]
+		case len(match) > 0:
+			return match[0]
+		}
+	}
+	return ""
+}
+
+// currentTicket is the manual override, or the ticket in the current
+// branch's name. Detached HEADs have no ticket, and neither has anything
+// while tickets are placed nowhere.
+func currentTicket(config TicketConfig, override string) string {
+	if config.Placement == "none" {
+		return ""
+	}
+	if override != "" {
+		return override
+	}
+	branch, err := runGit("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return findTicket(branch, config.BranchPatterns)
+}
+
+// ticketPrompt tells the model about the ticket. The ID itself is added
+// afterwards by applyTicket, so the model is asked to leave it out.
+func ticketPrompt(ticket string) string {
+	if ticket == "" {
+		return ""
+	}
+	return "The change belongs to ticket " + ticket + ". Don't mention the ticket ID, it is added separately.\n"
+}
+
+// applyTicket puts the ticket ID where the config says, unless the message
+// already mentions it
+func applyTicket(message string, ticket string, config TicketConfig) string {
+	if ticket == "" || config.Placement == "none" || strings.Contains(message, ticket) {
+		return message
+	}
+	switch config.Placement {
+	case "subject":
+		subject, rest, _ := strings.Cut(message, "\n")
+		prefix := strings.ReplaceAll(config.SubjectFormat, "{ticket}", ticket)
+		// Keep Conventional Commits headers parseable
+		if header, ok := parseConventionalHeader(subject, ""); ok {
+			subject = strings.TrimSuffix(subject, header.Description) + prefix + header.Description
+		} else {
+			subject = prefix + subject
+		}
+		if rest == "" {
+			return subject
+		}
+		return subject + "\n" + rest
+	case "body":
+		body, trailers := splitTrailers(message)
+		body += "\n\n" + config.TrailerKey + " " + ticket
+		if trailers != "" {
+			body += "\n\n" + trailers
+		}
+		return body
+	}
+	return addTrailer(message, config.TrailerKey, ticket)
+}
+
+// splitTrailers separates the trailer paragraph from the rest of a message
+func splitTrailers(message string) (string, string) {
+	message = strings.TrimSpace(message)
+	if len(parseTrailers(message)) == 0 {
+		return message, ""
+	}
+	index := strings.LastIndex(message, "\n\n")
+	return message[:index], message[index+2:]
+}
+
+// addTrailer appends a trailer, joining an existing trailer paragraph
+func addTrailer(message string, key string, value string) string {
+	body, trailers := splitTrailers(message)
+	if trailers == "" {
+		return body + "\n\n" + key + ": " + value
+	}
+	return body + "\n\n" + trailers + "\n" + key + ": " + value
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	dbmodel "aicommit/.gen/model"
+)
+
+const trailersPrompt = "Don't write trailers such as Signed-off-by or Co-authored-by, they are added separately.\n"
+
+// coAuthorTrailer formats a team member the way GitHub and GitLab recognize
+// co-authors
+func coAuthorTrailer(member dbmodel.TeamMember) string {
+	return fmt.Sprintf("Co-authored-by: %s <%s>", member.Name, member.Email)
+}
+
+// signOffTrailer certifies the commit for the DCO with the identity git
+// commits as, like git commit --signoff
+func signOffTrailer() (string, error) {
+	name, _ := runGit("config", "user.name")
+	email, _ := runGit("config", "user.email")
+	if name == "" || email == "" {
+		return "", errors.New("signing off needs user.name and user.email in the git config")
+	}
+	return fmt.Sprintf("Signed-off-by: %s <%s>", name, email), nil
+}
+
+// messageTrailers lists the trailers a message gets: the configured ones,
+// the co-authors, and the sign-off last as git puts it.
+func messageTrailers(config TrailerConfig, coAuthors []dbmodel.TeamMember) ([]string, error) {
+	trailers := append([]string{}, config.Custom...)
+	for _, member := range coAuthors {
+		trailers = append(trailers, coAuthorTrailer(member))
+	}
+	if config.SignOff {
+		signOff, err := signOffTrailer()
+		if err != nil {
+			return nil, err
+		}
+		trailers = append(trailers, signOff)
+	}
+	return trailers, nil
+}
+
+// appendTrailers adds trailers the way git interpret-trailers does, so the
+// user's trailer.* settings apply. A trailer is skipped when the message
+// already has the same key and value, which makes this safe to repeat.
+func appendTrailers(message string, trailers []string) (string, error) {
+	if len(trailers) == 0 {
+		return message, nil
+	}
+	args := []string{"interpret-trailers", "--no-divider", "--if-exists", "addIfDifferent"}
+	for _, t := range trailers {
+		args = append(args, "--trailer", t)
+	}
+	out, err := runGitRaw(strings.TrimSpace(message)+"\n", args...)
+	if err != nil {
+		return message, err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// removeTrailers drops the given trailers from the trailer paragraph
+func removeTrailers(message string, trailers []string) string {
+	body, paragraph := splitTrailers(message)
+	if paragraph == "" {
+		return body
+	}
+	var kept []string
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !StringInSlice(line, trailers) {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		return body
+	}
+	return body + "\n\n" + strings.Join(kept, "\n")
+}
+
+// finishMessage lays out a generated message by the rules and adds what
+// doesn't come from the model: the ticket and the trailers
+func finishMessage(message string, config RepoConfig, ticket string, coAuthors []dbmodel.TeamMember) (string, error) {
+	message = formatMessage(normalizeGitmoji(message, config.Lint), config.Lint)
+	message = applyTicket(message, ticket, config.Ticket)
+	trailers, err := messageTrailers(config.Trailers, coAuthors)
+	if err != nil {
+		return message, err
+	}
+	return appendTrailers(message, trailers)
+}
+
+func newTeamCmd(cdb *CommitDB) *cobra.Command {
+	cmdTeam := &cobra.Command{
+		Use:   "team",
+		Short: "Manage the roster co-authors are picked from",
+	}
+
+	cmdList := &cobra.Command{
+		Use:           "list",
+		Short:         "List the team members",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			members, err := cdb.GetTeamMembers()
+			if err != nil {
+				showFatalError(err)
+				return err
+			}
+			if len(members) == 0 {
+				fmt.Println("No team members yet, add one with: aicommit team add <name> <email>")
+			}
+			for _, member := range members {
+				fmt.Printf("%s <%s>\n", member.Name, member.Email)
+			}
+			return nil
+		},
+	}
+
+	cmdAdd := &cobra.Command{
+		Use:           "add <name> <email>",
+		Short:         "Add a team member, or rename the one with that email",
+		Args:          cobra.ExactArgs(2),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				name := strings.TrimSpace(args[0])
+				address, err := mail.ParseAddress(args[1])
+				if err != nil || name == "" || strings.ContainsAny(name, "<>\n") {
+					return fmt.Errorf("expected a name and an email, got %q and %q", args[0], args[1])
+				}
+				dateCreated := time.Now()
+				_, err = cdb.UpsertTeamMember(dbmodel.TeamMember{
+					Name:        name,
+					Email:       address.Address,
+					DateCreated: &dateCreated,
+				})
+				return err
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+
+	cmdRemove := &cobra.Command{
+		Use:           "remove <email>",
+		Short:         "Remove a team member",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := func() error {
+				result, err := cdb.DeleteTeamMember(args[0])
+				if err != nil {
+					return err
+				}
+				if removed, _ := result.RowsAffected(); removed == 0 {
+					return fmt.Errorf("no team member with email %s", args[0])
+				}
+				return nil
+			}()
+			if err != nil {
+				showFatalError(err)
+			}
+			return err
+		},
+	}
+
+	cmdTeam.AddCommand(cmdList, cmdAdd, cmdRemove)
+	return cmdTeam
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// withUmask runs f as is where there is no umask
+func withUmask(mask int, f func() error) error {
+	return f()
+}
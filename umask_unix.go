@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// withUmask runs f with the given file mode creation mask, so files it
+// creates never exist with looser permissions
+func withUmask(mask int, f func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return f()
+}
@@ -8,3 +8,20 @@ func StringInSlice(s string, list []string) bool {
 	}
 	return false
 }
+
+func intInSlice(n int, list []int) bool {
+	for _, x := range list {
+		if n == x {
+			return true
+		}
+	}
+	return false
+}
+
+// derefString reads an optional database column, treating NULL as empty
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}